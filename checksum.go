@@ -0,0 +1,191 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+)
+
+// hashRegistry holds constructors of checksum algorithms.
+// Each checksum calculation gets a fresh instance, so it is safe to hash in parallel.
+var hashRegistry = struct {
+	sync.RWMutex
+	m map[string]func() hash.Hash
+}{m: make(map[string]func() hash.Hash)}
+
+func init() {
+	RegisterHash("md5", md5.New)
+	RegisterHash("sha1", sha1.New)
+	RegisterHash("sha224", sha256.New224)
+	RegisterHash("sha256", sha256.New)
+	RegisterHash("sha384", sha512.New384)
+	RegisterHash("sha512", sha512.New)
+	RegisterHash("crc32", func() hash.Hash { return crc32.NewIEEE() })
+	RegisterHash("blake2b", func() hash.Hash {
+		h, _ := blake2b.New512(nil) // error is returned only for an invalid key
+		return h
+	})
+	RegisterHash("blake2s", func() hash.Hash {
+		h, _ := blake2s.New256(nil) // error is returned only for an invalid key
+		return h
+	})
+}
+
+// RegisterHash registers a constructor of checksum algorithm name.
+// It replaces the constructor if name is already registered.
+func RegisterHash(name string, f func() hash.Hash) {
+	hashRegistry.Lock()
+	defer hashRegistry.Unlock()
+	hashRegistry.m[name] = f
+}
+
+// NewHash returns a new hash.Hash of checksum algorithm name.
+func NewHash(name string) (hash.Hash, error) {
+	hashRegistry.RLock()
+	f, ok := hashRegistry.m[name]
+	hashRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown checksum :%s", name)
+	}
+	return f(), nil
+}
+
+// HashNames returns registered checksum algorithms in lexical order.
+func HashNames() []string {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+
+	ret := []string{}
+	for k := range hashRegistry.m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ChecksumList is a list of checksum algorithms.
+// It can be decoded from a JSON string or an array of strings.
+type ChecksumList []string
+
+func (l *ChecksumList) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("\"")) {
+		var s string
+		err := json.Unmarshal(b, &s)
+		if err != nil {
+			return err
+		}
+		*l = ChecksumList{}
+		if s != "" {
+			*l = append(*l, s)
+		}
+		return nil
+	}
+
+	var a []string
+	err := json.Unmarshal(b, &a)
+	if err != nil {
+		return err
+	}
+	*l = ChecksumList(a)
+	return nil
+}
+
+// MultiHash calculates checksums of several algorithms in one pass.
+type MultiHash struct {
+	names  []string
+	hashes []hash.Hash
+}
+
+// NewMultiHash returns a MultiHash of names. Duplicated names are ignored.
+func NewMultiHash(names []string) (*MultiHash, error) {
+	m := &MultiHash{}
+	for _, v := range names {
+		if _, ok := m.index(v); ok {
+			continue
+		}
+		h, err := NewHash(v)
+		if err != nil {
+			return nil, err
+		}
+		m.names = append(m.names, v)
+		m.hashes = append(m.hashes, h)
+	}
+	return m, nil
+}
+
+func (m *MultiHash) index(name string) (int, bool) {
+	for i, v := range m.names {
+		if v == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Write writes p to all hashes.
+func (m *MultiHash) Write(p []byte) (int, error) {
+	for _, h := range m.hashes {
+		// hash.Hash never returns an error.
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sums returns checksums keyed by algorithm name.
+func (m *MultiHash) Sums() map[string][]byte {
+	ret := make(map[string][]byte)
+	for i, v := range m.names {
+		ret[v] = m.hashes[i].Sum(nil)
+	}
+	return ret
+}
+
+// ChecksumFile calculates checksums of path in one read.
+// The file is read in a streaming way to keep memory usage flat.
+func ChecksumFile(path string, names []string) (map[string][]byte, error) {
+	m, err := NewMultiHash(names)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(m, f)
+	if err != nil {
+		return nil, err
+	}
+	return m.Sums(), nil
+}
@@ -0,0 +1,174 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"sync"
+	"testing"
+)
+
+func TestNewHash(t *testing.T) {
+	type testcase struct {
+		sumType string
+		expect  string
+	}
+	cases := []testcase{
+		{"sha224", "d1884e711701ad81abe0c77a3b0ea12e19ba9af64077286c72fc602d"},
+		{"sha384", "9f11fc131123f844c1226f429b6a0a6af0525d9f40f056c7fc16cdf1b06bda08e302554417a59fa7dcf6247421959d22"},
+		{"sha512", "d716a4188569b68ab1b6dfac178e570114cdf0ea3a1cc0e31486c3e41241bc6a76424e8c37ab26f096fc85ef9886c8cb634187f4fddff645fb099f1ff54c6b8c"},
+		{"crc32", "312a6aa6"},
+		{"blake2b", "81e659403d5bfd8aa7f8ef2beab97c4b866a27b0d1079d1d97e6915f65d6e947f4b2efea807c4568fa6e201dd79c4a82d6988c71b7cc4a9673575cb3a1cb2202"},
+		{"blake2s", "4468a2b5329224c54c243d4fae24cdf050a27a563480f4af5fedd4446d8c4a04"},
+	}
+
+	for _, v := range cases {
+		h, err := NewHash(v.sumType)
+		if err != nil {
+			t.Errorf("%s:%s", v.sumType, err)
+			continue
+		}
+		h.Write([]byte("abcdefg"))
+		sumstr := fmt.Sprintf("%x", h.Sum(nil))
+		if sumstr != v.expect {
+			t.Errorf("%s error:\n given =%s\n expect=%s", v.sumType, sumstr, v.expect)
+		}
+	}
+
+	_, err := NewHash("unknown")
+	if err == nil {
+		t.Errorf("unknown should be error")
+	}
+}
+
+func TestNewHashFreshInstance(t *testing.T) {
+	expect := "7d1a54127b222502f5b79b5fb0803061152a44f92b37e23c6527baf665d4da9a"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := NewHash("sha256")
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, c := range []byte("abcdefg") {
+				h.Write([]byte{c})
+			}
+			if s := fmt.Sprintf("%x", h.Sum(nil)); s != expect {
+				errs <- fmt.Errorf("given %s expect %s", s, expect)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRegisterHash(t *testing.T) {
+	RegisterHash("adler32", func() hash.Hash { return adler32.New() })
+
+	found := false
+	for _, v := range HashNames() {
+		if v == "adler32" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("adler32 is not registered %v", HashNames())
+	}
+
+	h, err := NewHash("adler32")
+	if err != nil {
+		t.Fatalf("NewHash:%s", err)
+	}
+	h.Write([]byte("abcdefg"))
+	if s := fmt.Sprintf("%x", h.Sum(nil)); s != "0adb02bd" {
+		t.Errorf("given %s", s)
+	}
+}
+
+func TestChecksumListUnmarshal(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  string
+		expect []string
+	}
+
+	cases := []testcase{
+		{"string", `"md5"`, []string{"md5"}},
+		{"blank string", `""`, []string{}},
+		{"array", `["md5", "sha256"]`, []string{"md5", "sha256"}},
+	}
+
+	for _, v := range cases {
+		l := ChecksumList{}
+		err := json.Unmarshal([]byte(v.input), &l)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if len(l) != len(v.expect) {
+			t.Errorf("%s:given %v expect %v", v.name, l, v.expect)
+			continue
+		}
+		for i := range l {
+			if l[i] != v.expect[i] {
+				t.Errorf("%s:given %v expect %v", v.name, l, v.expect)
+			}
+		}
+	}
+
+	l := ChecksumList{}
+	err := json.Unmarshal([]byte(`1`), &l)
+	if err == nil {
+		t.Errorf("number should be error")
+	}
+}
+
+func TestMultiHash(t *testing.T) {
+	m, err := NewMultiHash([]string{"md5", "sha1", "md5"})
+	if err != nil {
+		t.Fatalf("NewMultiHash:%s", err)
+	}
+	m.Write([]byte("abcdefg"))
+
+	sums := m.Sums()
+	if len(sums) != 2 {
+		t.Errorf("given %d sums expect 2", len(sums))
+	}
+	if s := fmt.Sprintf("%x", sums["md5"]); s != "7ac66c0f148de9519b8bd264312c4d64" {
+		t.Errorf("md5:given %s", s)
+	}
+	if s := fmt.Sprintf("%x", sums["sha1"]); s != "2fb5e13419fc89246865e7a324f476ec624e8740" {
+		t.Errorf("sha1:given %s", s)
+	}
+
+	_, err = NewMultiHash([]string{"md5", "unknown"})
+	if err == nil {
+		t.Errorf("unknown should be error")
+	}
+}
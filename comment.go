@@ -0,0 +1,50 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+// StripComments replaces "//" comments in JSON with spaces.
+// Comments in strings are kept. The length and line numbers of b are not changed
+// to report positions of errors in the original file.
+func StripComments(b []byte) []byte {
+	ret := make([]byte, len(b))
+	copy(ret, b)
+
+	inString := false
+	for i := 0; i < len(ret); i++ {
+		c := ret[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			continue
+		}
+		if c == '/' && i+1 < len(ret) && ret[i+1] == '/' {
+			for ; i < len(ret) && ret[i] != '\n'; i++ {
+				if ret[i] != '\r' {
+					ret[i] = ' '
+				}
+			}
+		}
+	}
+	return ret
+}
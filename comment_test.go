@@ -0,0 +1,45 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  string
+		expect string
+	}
+
+	cases := []testcase{
+		{"no comment", `{"a":"b"}`, `{"a":"b"}`},
+		{"line", "// c\n{}", "    \n{}"},
+		{"trailing", "{\"a\":1} // c\n", "{\"a\":1}     \n"},
+		{"in string", `{"a":"http://example.com"}`, `{"a":"http://example.com"}`},
+		{"escaped quote", `{"a":"\"//"} //`, `{"a":"\"//"}   `},
+		{"single slash", `{"a":"/"}/`, `{"a":"/"}/`},
+	}
+
+	for _, v := range cases {
+		ret := string(StripComments([]byte(v.input)))
+		if ret != v.expect {
+			t.Errorf("%s:given %q expect %q", v.name, ret, v.expect)
+		}
+	}
+}
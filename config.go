@@ -19,18 +19,38 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 )
 
 // ConfigArgsMissing represents no Args error
 var ConfigNoArgs error = errors.New("No Args")
 
+// newFlagSet returns a FlagSet of a sub command.
+// usage is printed after "Usage: file-collector " with help message.
+func newFlagSet(name string, usage string, silent bool) *flag.FlagSet {
+	opt := flag.NewFlagSet(name, flag.ContinueOnError)
+	opt.Usage = func() {
+		fmt.Fprintf(opt.Output(), "Usage: file-collector %s\n", usage)
+		opt.PrintDefaults()
+	}
+	if silent {
+		opt.SetOutput(ioutil.Discard)
+	}
+	return opt
+}
+
+// Config is a configuration of run command.
 type Config struct {
 	showVersion    bool
 	ConfigFilePath string
+	Format         string
+	Jobs           int // overrides parallelism if not 0
 }
 
-// Pass os.Args[1:]
+// Configure parses args of run command.
+// -V is kept for "file-collector -V".
+// Pass os.Args[2:], or os.Args[1:] if the command is omitted.
 // silent is to suppress help message for testing.
 func Configure(args []string, silent bool) (*Config, error) {
 	ret := &Config{}
@@ -38,15 +58,125 @@ func Configure(args []string, silent bool) (*Config, error) {
 		return nil, ConfigNoArgs
 	}
 
-	opt := flag.NewFlagSet("simple", flag.ContinueOnError)
+	opt := newFlagSet("run", "run -c config.json", silent)
 	opt.BoolVar(&ret.showVersion, "V", false, "show Version")
 	opt.StringVar(&ret.ConfigFilePath, "c", "", "config file path")
+	opt.StringVar(&ret.Format, "format", "", "config file format. json, yaml or toml. default: guessed from the extension")
+	opt.IntVar(&ret.Jobs, "jobs", 0, "number of srcs copied concurrently. default: parallelism of the config")
 
-	if silent {
-		opt.SetOutput(ioutil.Discard)
+	err := opt.Parse(args)
+
+	return ret, err
+}
+
+// ConfigureVersion parses args of version command.
+// Pass os.Args[2:]
+func ConfigureVersion(args []string, silent bool) error {
+	opt := newFlagSet("version", "version", silent)
+	return opt.Parse(args)
+}
+
+// ValidateConfig is a configuration of validate command.
+type ValidateConfig struct {
+	ConfigFilePath string
+	Format         string
+}
+
+// ConfigureValidate parses args of validate command.
+// Pass os.Args[2:]
+func ConfigureValidate(args []string, silent bool) (*ValidateConfig, error) {
+	ret := &ValidateConfig{}
+
+	opt := newFlagSet("validate", "validate -c config.json", silent)
+	opt.StringVar(&ret.ConfigFilePath, "c", "", "config file path")
+	opt.StringVar(&ret.Format, "format", "", "config file format. json, yaml or toml. default: guessed from the extension")
+
+	err := opt.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if ret.ConfigFilePath == "" {
+		return nil, fmt.Errorf("config file is missing")
+	}
+	return ret, nil
+}
+
+// InitConfig is a configuration of init command.
+type InitConfig struct {
+	OutputPath string
+	Force      bool
+}
+
+// ConfigureInit parses args of init command.
+// Pass os.Args[2:]
+func ConfigureInit(args []string, silent bool) (*InitConfig, error) {
+	ret := &InitConfig{}
+
+	opt := newFlagSet("init", "init [-o config.json] [-f]", silent)
+	opt.StringVar(&ret.OutputPath, "o", "config.json", "path of the config file to create. \"-\" means stdout")
+	opt.BoolVar(&ret.Force, "f", false, "overwrite an existing file")
+
+	err := opt.Parse(args)
+	if err != nil {
+		return nil, err
 	}
+	return ret, nil
+}
+
+// VerifyConfig is a configuration of verify command.
+type VerifyConfig struct {
+	ConfigFilePath string
+	Format         string
+	DstDir         string
+	ManifestName   string
+	Algorithm      string
+}
+
+// ConfigureVerify parses args of verify command.
+// Pass os.Args[2:]
+func ConfigureVerify(args []string, silent bool) (*VerifyConfig, error) {
+	ret := &VerifyConfig{}
+
+	opt := newFlagSet("verify", "verify -c config.json | -d dir [-m manifest] [-a algorithm]", silent)
+	opt.StringVar(&ret.ConfigFilePath, "c", "", "config file path. dst and manifest are read from it")
+	opt.StringVar(&ret.Format, "format", "", "config file format. json, yaml or toml. default: guessed from the extension")
+	opt.StringVar(&ret.DstDir, "d", "", "directory to verify")
+	opt.StringVar(&ret.ManifestName, "m", "", "manifest file name under the directory")
+	opt.StringVar(&ret.Algorithm, "a", "", "checksum algorithm of the manifest")
 
 	err := opt.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if ret.ConfigFilePath == "" && ret.DstDir == "" {
+		return nil, fmt.Errorf("config file or directory is missing")
+	}
+	return ret, nil
+}
 
-	return ret, err
+// PlanConfig is a configuration of plan command.
+type PlanConfig struct {
+	ConfigFilePath string
+	Format         string
+	JSON           bool
+}
+
+// ConfigurePlan parses args of plan command.
+// Pass os.Args[2:]
+func ConfigurePlan(args []string, silent bool) (*PlanConfig, error) {
+	ret := &PlanConfig{}
+
+	opt := newFlagSet("plan", "plan -c config.json [-json]", silent)
+	opt.StringVar(&ret.ConfigFilePath, "c", "", "config file path")
+	opt.StringVar(&ret.Format, "format", "", "config file format. json, yaml or toml. default: guessed from the extension")
+	opt.BoolVar(&ret.JSON, "json", false, "print the plan as JSON")
+
+	err := opt.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if ret.ConfigFilePath == "" {
+		return nil, fmt.Errorf("config file is missing")
+	}
+	return ret, nil
 }
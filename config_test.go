@@ -42,3 +42,122 @@ func TestConfigure(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigureVerify(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   []string
+		success bool
+	}
+
+	cases := []testcase{
+		{"no args", []string{}, false},
+		{"help", []string{"-h"}, false},
+		{"config", []string{"-c", "config.json"}, true},
+		{"dir", []string{"-d", "release", "-m", "SUMS", "-a", "md5"}, true},
+	}
+
+	for _, v := range cases {
+		_, err := ConfigureVerify(v.input, true)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+	}
+}
+
+func TestConfigurePlan(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   []string
+		success bool
+	}
+
+	cases := []testcase{
+		{"no args", []string{}, false},
+		{"help", []string{"-h"}, false},
+		{"config", []string{"-c", "config.json"}, true},
+		{"json", []string{"-c", "config.json", "-json"}, true},
+	}
+
+	for _, v := range cases {
+		_, err := ConfigurePlan(v.input, true)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+	}
+}
+
+func TestConfigureValidate(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   []string
+		success bool
+	}
+
+	cases := []testcase{
+		{"no args", []string{}, false},
+		{"help", []string{"-h"}, false},
+		{"config", []string{"-c", "config.json"}, true},
+	}
+
+	for _, v := range cases {
+		_, err := ConfigureValidate(v.input, true)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+	}
+}
+
+func TestConfigureInit(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  []string
+		expect InitConfig
+	}
+
+	cases := []testcase{
+		{"default", []string{}, InitConfig{OutputPath: "config.json"}},
+		{"output", []string{"-o", "a.json", "-f"}, InitConfig{OutputPath: "a.json", Force: true}},
+	}
+
+	for _, v := range cases {
+		cnf, err := ConfigureInit(v.input, true)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if *cnf != v.expect {
+			t.Errorf("%s:given %v expect %v", v.name, *cnf, v.expect)
+		}
+	}
+}
+
+func TestConfigureJobs(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  []string
+		expect int
+	}
+
+	cases := []testcase{
+		{"default", []string{"-c", "config.json"}, 0},
+		{"jobs", []string{"-c", "config.json", "--jobs", "4"}, 4},
+	}
+
+	for _, v := range cases {
+		cnf, err := Configure(v.input, true)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if cnf.Jobs != v.expect {
+			t.Errorf("%s:given %d expect %d", v.name, cnf.Jobs, v.expect)
+		}
+	}
+}
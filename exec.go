@@ -17,29 +17,288 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
 )
 
-func execCommand(f map[string]string, args []string, outio io.Writer, errio io.Writer) error {
-	if len(args) < 1 {
-		return fmt.Errorf("command not found")
+// Command is a command executed before or after copying.
+// It is an array of arguments or an object.
+//
+//	["gzip", "${target}"]
+//	{"cmd": "gzip -c ${target} > ${target}.gz", "shell": true, "env": {"GZIP": "-9"}}
+type Command struct {
+	Args    []string          `json:"cmd"`               // arguments. It is a command line in shell mode.
+	Shell   bool              `json:"shell,omitempty"`   // execute with "sh -c"
+	Env     map[string]string `json:"env,omitempty"`     // additional environment variables
+	Timeout Duration          `json:"timeout,omitempty"` // kill the command after it. 0 means no timeout
+	Retries int               `json:"retries,omitempty"` // times to retry after a failure
+	Backoff Duration          `json:"backoff,omitempty"` // wait before the first retry. It doubles on each retry
+	Cwd     string            `json:"cwd,omitempty"`     // working directory
+	Stdin   string            `json:"stdin,omitempty"`   // file passed as stdin. default: empty
+}
+
+// DefaultBackoff is the wait before the first retry if backoff is not set.
+const DefaultBackoff = Duration(time.Second)
+
+// plainCommand is Command without methods.
+type plainCommand Command
+
+// command is to decode the object form.
+// Cmd hides Args of plainCommand.
+type command struct {
+	plainCommand
+	Cmd json.RawMessage `json:"cmd"`
+}
+
+// UnmarshalJSON accepts an array of arguments or an object.
+// "cmd" of the object is a string or an array of string.
+func (c *Command) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if !bytes.HasPrefix(b, []byte("{")) {
+		var args []string
+		err := json.Unmarshal(b, &args)
+		if err != nil {
+			return fmt.Errorf("command should be an array of string or an object")
+		}
+		*c = Command{Args: args}
+		return nil
+	}
+
+	var obj command
+	err := decodeObject(b, &obj)
+	if err != nil {
+		return err
+	}
+	ret := Command(obj.plainCommand)
+	if bytes.HasPrefix(bytes.TrimSpace(obj.Cmd), []byte("\"")) {
+		var line string
+		err = json.Unmarshal(obj.Cmd, &line)
+		ret.Args = []string{line}
+	} else if len(obj.Cmd) > 0 {
+		err = json.Unmarshal(obj.Cmd, &ret.Args)
+	}
+	if err != nil {
+		return fmt.Errorf("cmd should be a string or an array of string")
+	}
+	err = ret.CheckConfiguration()
+	if err != nil {
+		return err
+	}
+	*c = ret
+	return nil
+}
+
+// CheckConfiguration checks options of c.
+// A command line of shell mode is a string since arguments of an array would be split by the shell.
+func (c Command) CheckConfiguration() error {
+	if c.Retries < 0 {
+		return fmt.Errorf("retries should not be negative")
 	}
+	if c.Shell && len(c.Args) > 1 {
+		return fmt.Errorf("cmd should be a string in shell mode")
+	}
+	return nil
+}
 
-	// replace placeholder
+// MarshalJSON writes an array of arguments if the object form is not needed.
+func (c Command) MarshalJSON() ([]byte, error) {
+	simple := !c.Shell && len(c.Env) == 0 && c.Timeout == 0 && c.Retries == 0 && c.Backoff == 0 && c.Cwd == "" && c.Stdin == ""
+	if simple && c.IsEmpty() {
+		return []byte("null"), nil
+	}
+	if simple {
+		return json.Marshal(c.Args)
+	}
+	if c.Shell && len(c.Args) == 1 {
+		line, err := json.Marshal(c.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(command{plainCommand: plainCommand(c), Cmd: line})
+	}
+	return json.Marshal(plainCommand(c))
+}
+
+// Duration is a time.Duration in JSON like "30s" or a number of seconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var sec float64
+	if err := json.Unmarshal(b, &sec); err != nil {
+		return fmt.Errorf("duration should be a string like \"30s\" or seconds")
+	}
+	*d = Duration(sec * float64(time.Second))
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// IsEmpty reports whether c has no command.
+func (c Command) IsEmpty() bool {
+	return len(c.Args) == 0
+}
+
+// Argv returns arguments to execute whose placeholders are replaced.
+// In shell mode, Args has only a command line and values are quoted not to be interpreted by the shell
+// since they may come from any file name.
+func (c Command) Argv(f map[string]string) []string {
+	if c.Shell {
+		quoted := make(map[string]string)
+		for k, v := range f {
+			quoted[k] = shellQuote(v)
+		}
+		return []string{"sh", "-c", strings.Join(expandArgs(quoted, c.Args), " ")}
+	}
+	return expandArgs(f, c.Args)
+}
+
+// shellQuote returns s as a single quoted word of sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// environ returns environment variables of the command.
+// Each placeholder like ${dst_root} is also passed as FC_DST_ROOT.
+// Values are not quoted since the shell doesn't interpret values of environment variables.
+func (c Command) environ(f map[string]string) []string {
+	ret := os.Environ()
+	keys := []string{}
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := strings.TrimSuffix(strings.TrimPrefix(k, "${"), "}")
+		ret = append(ret, "FC_"+strings.ToUpper(name)+"="+f[k])
+	}
+
+	keys = []string{}
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ret = append(ret, k+"="+expandArgs(f, []string{c.Env[k]})[0])
+	}
+	return ret
+}
+
+// expandArgs returns a copy of args whose placeholders are replaced.
+// Placeholders in an argument like "--file=${target}" are also replaced.
+// args may be shared among expanded sources. Don't modify it.
+func expandArgs(f map[string]string, args []string) []string {
+	pairs := []string{}
 	for k, v := range f {
-		for i, arg := range args {
-			if strings.Compare(k, arg) == 0 {
-				args[i] = v
-			}
+		pairs = append(pairs, k, v)
+	}
+	r := strings.NewReplacer(pairs...)
+
+	ret := make([]string, len(args))
+	for i, arg := range args {
+		ret[i] = r.Replace(arg)
+	}
+	return ret
+}
+
+// CommandError is an error of a command which failed after all attempts.
+type CommandError struct {
+	Args     []string
+	Attempts int
+	ExitCode int      // -1 if the command didn't exit by itself
+	Stderr   []string // last lines of stderr of the last attempt
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	ret := fmt.Sprintf("%s:%s (attempts:%d exit code:%d)\n", e.Args, e.Err, e.Attempts, e.ExitCode)
+	if len(e.Stderr) > 0 {
+		ret += "stderr:\n  " + strings.Join(e.Stderr, "\n  ") + "\n"
+	}
+	return ret
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+func execCommand(f map[string]string, c Command, outio io.Writer, errio io.Writer) error {
+	if c.IsEmpty() {
+		return fmt.Errorf("command not found")
+	}
+
+	args := c.Argv(f)
+	backoff := time.Duration(c.Backoff)
+	if backoff == 0 {
+		backoff = time.Duration(DefaultBackoff)
+	}
+
+	var err error
+	var tail *tailWriter
+	attempts := 0
+	for attempts < c.Retries+1 {
+		if attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		attempts++
+		tail = &tailWriter{n: StderrTailLines}
+		var w io.Writer = tail
+		if errio != nil {
+			w = io.MultiWriter(errio, tail)
+		}
+		err = c.run(f, args, outio, w)
+		if err == nil {
+			return nil
 		}
 	}
 
+	code := -1
+	var exiterr *exec.ExitError
+	if errors.As(err, &exiterr) {
+		code = exiterr.ExitCode()
+	}
+	return &CommandError{Args: args, Attempts: attempts, ExitCode: code, Stderr: tail.Lines(), Err: err}
+}
+
+// run executes args once. The process group is killed on timeout.
+func (c Command) run(f map[string]string, args []string, outio io.Writer, errio io.Writer) error {
 	var cmd *exec.Cmd
 
 	cmd = exec.Command(args[0], args[1:]...)
+	cmd.Env = c.environ(f)
+	if c.Cwd != "" {
+		cmd.Dir = expandArgs(f, []string{c.Cwd})[0]
+	}
+	if c.Stdin != "" {
+		in, err := os.Open(expandArgs(f, []string{c.Stdin})[0])
+		if err != nil {
+			return fmt.Errorf("stdin:%w", err)
+		}
+		defer in.Close()
+		cmd.Stdin = in
+	}
 	//	fmt.Printf("cmd:%s %s\n", cmdargs[0], cmdargs[1:])
 	if outio != nil {
 		cmd.Stdout = outio
@@ -47,10 +306,28 @@ func execCommand(f map[string]string, args []string, outio io.Writer, errio io.W
 	if errio != nil {
 		cmd.Stderr = errio
 	}
+	setProcessGroup(cmd)
 
-	err := cmd.Run()
+	err := cmd.Start()
 	if err != nil {
-		return fmt.Errorf("%s:%s\n", args, err)
+		return err
+	}
+	if c.Timeout <= 0 {
+		return cmd.Wait()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(time.Duration(c.Timeout))
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		return err
+	case <-timer.C:
+		killProcessGroup(cmd)
+		<-done
+		return fmt.Errorf("timeout after %s", time.Duration(c.Timeout))
 	}
-	return nil
 }
@@ -0,0 +1,309 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandUnmarshal(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   string
+		expect  Command
+		success bool
+	}
+
+	cases := []testcase{
+		{"array", `["echo", "${target}"]`, Command{Args: []string{"echo", "${target}"}}, true},
+		{"null", `null`, Command{}, true},
+		{"object", `{"cmd":["echo", "a"], "env":{"A":"B"}}`, Command{Args: []string{"echo", "a"}, Env: map[string]string{"A": "B"}}, true},
+		{"shell", `{"cmd":"echo a | wc -l", "shell":true}`, Command{Args: []string{"echo a | wc -l"}, Shell: true}, true},
+		{"string", `"echo"`, Command{}, false},
+		{"unknown field", `{"cmd":"echo", "shel":true}`, Command{}, false},
+		{"wrong cmd", `{"cmd":1}`, Command{}, false},
+		{"options", `{"cmd":["sign", "${target}"], "timeout":"30s", "retries":2, "backoff":1, "cwd":"/tmp", "stdin":"pin.txt"}`,
+			Command{Args: []string{"sign", "${target}"}, Timeout: Duration(30 * time.Second), Retries: 2, Backoff: Duration(time.Second), Cwd: "/tmp", Stdin: "pin.txt"}, true},
+		{"negative retries", `{"cmd":"ls", "retries":-1}`, Command{}, false},
+		{"shell line array", `{"cmd":["echo a | wc -l"], "shell":true}`, Command{Args: []string{"echo a | wc -l"}, Shell: true}, true},
+		{"shell array", `{"cmd":["echo", "a b"], "shell":true}`, Command{}, false},
+		{"shell options", `{"cmd":"echo a", "shell":true, "retries":1}`, Command{Args: []string{"echo a"}, Shell: true, Retries: 1}, true},
+	}
+
+	for _, v := range cases {
+		c := Command{}
+		err := json.Unmarshal([]byte(v.input), &c)
+		if !v.success {
+			if err == nil {
+				t.Errorf("%s:it should be error", v.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, v.expect) {
+			t.Errorf("%s:given %v expect %v", v.name, c, v.expect)
+		}
+
+		// round trip
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Errorf("%s:Marshal:%s", v.name, err)
+			continue
+		}
+		c2 := Command{}
+		err = json.Unmarshal(b, &c2)
+		if err != nil || !reflect.DeepEqual(c, c2) {
+			t.Errorf("%s:given %s %v", v.name, string(b), err)
+		}
+	}
+}
+
+func TestExecCommandShellEnv(t *testing.T) {
+	f := map[string]string{"${src}": "a.txt", "${dst_root}": "/tmp/release", "${checksum}": "abcd"}
+
+	type testcase struct {
+		name   string
+		input  Command
+		expect string
+	}
+
+	cases := []testcase{
+		{"shell", Command{Args: []string{"echo a b | wc -w"}, Shell: true}, "2"},
+		{"shell placeholder", Command{Args: []string{"echo ${src} && echo x"}, Shell: true}, "a.txt\nx"},
+		{"env", Command{Args: []string{"sh", "-c", "echo $FC_SRC $FC_DST_ROOT $FC_CHECKSUM"}}, "a.txt /tmp/release abcd"},
+		{"user env", Command{Args: []string{"echo $NAME"}, Shell: true, Env: map[string]string{"NAME": "${src}.gz"}}, "a.txt.gz"},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, v := range cases {
+		buf.Reset()
+		err := execCommand(f, v.input, buf, buf)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		ret := string(bytes.TrimSpace(buf.Bytes()))
+		if ret != v.expect {
+			t.Errorf("%s:given %s expect %s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestExecCommandShellQuote(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  Command
+		expect string
+	}
+
+	tmpdir, err := ioutil.TempDir("", "shellquote")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	names := []string{"a b.txt", "a; touch INJECTED #.txt", "$(touch INJECTED).txt", "it's `touch INJECTED`.txt"}
+	for _, name := range names {
+		err = ioutil.WriteFile(filepath.Join(tmpdir, name), []byte("a"), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile:%s", err)
+		}
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, name := range names {
+		f := map[string]string{"${target}": name, "${basename}": name}
+		cases := []testcase{
+			{"echo", Command{Args: []string{"echo ${target}"}, Shell: true, Cwd: tmpdir}, name},
+			{"test", Command{Args: []string{"test -f ${target} && echo ok"}, Shell: true, Cwd: tmpdir}, "ok"},
+			{"in an argument", Command{Args: []string{"echo x${basename}.gz"}, Shell: true, Cwd: tmpdir}, "x" + name + ".gz"},
+			{"env", Command{Args: []string{"echo $NAME"}, Shell: true, Cwd: tmpdir, Env: map[string]string{"NAME": "${target}"}}, name},
+		}
+
+		for _, v := range cases {
+			buf.Reset()
+			err := execCommand(f, v.input, buf, buf)
+			if err != nil {
+				t.Errorf("%s %s:%s", name, v.name, err)
+				continue
+			}
+			ret := string(bytes.TrimSpace(buf.Bytes()))
+			if ret != v.expect {
+				t.Errorf("%s %s:given %s expect %s", name, v.name, ret, v.expect)
+			}
+		}
+	}
+
+	if ok, _ := exists(filepath.Join(tmpdir, "INJECTED")); ok {
+		t.Errorf("a file name is executed")
+	}
+}
+
+func TestDurationUnmarshal(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   string
+		expect  time.Duration
+		success bool
+	}
+
+	cases := []testcase{
+		{"string", `"1m30s"`, 90 * time.Second, true},
+		{"seconds", `2.5`, 2500 * time.Millisecond, true},
+		{"invalid", `"10"`, 0, false},
+		{"bool", `true`, 0, false},
+	}
+
+	for _, v := range cases {
+		var d Duration
+		err := json.Unmarshal([]byte(v.input), &d)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		} else if time.Duration(d) != v.expect {
+			t.Errorf("%s:given %s expect %s", v.name, time.Duration(d), v.expect)
+		}
+	}
+}
+
+func TestExecCommandTimeout(t *testing.T) {
+	// the child of sh also should be killed. Otherwise Wait blocks until it exits.
+	c := Command{Args: []string{"sleep 10 & sleep 10"}, Shell: true, Timeout: Duration(100 * time.Millisecond)}
+
+	buf := bytes.NewBuffer([]byte{})
+	start := time.Now()
+	err := execCommand(nil, c, buf, buf)
+	if err == nil {
+		t.Fatalf("timeout should be error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("the command is not killed")
+	}
+	var cerr *CommandError
+	if !errors.As(err, &cerr) || cerr.Attempts != 1 || cerr.ExitCode != -1 {
+		t.Errorf("given %v", err)
+	}
+	if !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("given %s", err)
+	}
+}
+
+func TestExecCommandRetries(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "retries")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	type testcase struct {
+		name     string
+		retries  int
+		success  bool
+		attempts int
+	}
+
+	// it succeeds at the third attempt.
+	cases := []testcase{
+		{"no retry", 0, false, 1},
+		{"not enough", 1, false, 2},
+		{"retry", 2, true, 3},
+		{"more", 5, true, 3},
+	}
+
+	for _, v := range cases {
+		count := filepath.Join(tmpdir, v.name)
+		c := Command{Args: []string{"echo x >> '" + count + "'; exit $(( $(wc -l < '" + count + "') < 3 ? 7 : 0 ))"},
+			Shell: true, Retries: v.retries, Backoff: Duration(time.Millisecond)}
+		err := execCommand(nil, c, nil, nil)
+		if v.success {
+			if err != nil {
+				t.Errorf("%s:%s", v.name, err)
+			}
+		} else {
+			var cerr *CommandError
+			if !errors.As(err, &cerr) {
+				t.Errorf("%s:given %v", v.name, err)
+			} else if cerr.Attempts != v.attempts || cerr.ExitCode != 7 {
+				t.Errorf("%s:given attempts:%d exit code:%d expect %d 7", v.name, cerr.Attempts, cerr.ExitCode, v.attempts)
+			}
+		}
+		b, err := ioutil.ReadFile(count)
+		if err != nil {
+			t.Fatalf("%s:ReadFile:%s", v.name, err)
+		}
+		if n := bytes.Count(b, []byte("\n")); n != v.attempts {
+			t.Errorf("%s:given %d attempts expect %d", v.name, n, v.attempts)
+		}
+	}
+}
+
+func TestExecCommandCwdStdin(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "cwdstdin")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	tmpdir, err = filepath.EvalSymlinks(tmpdir)
+	if err != nil {
+		t.Fatalf("EvalSymlinks:%s", err)
+	}
+
+	in := filepath.Join(tmpdir, "in.txt")
+	err = ioutil.WriteFile(in, []byte("input"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+
+	f := map[string]string{"${dst_root}": tmpdir}
+	buf := bytes.NewBuffer([]byte{})
+	err = execCommand(f, Command{Args: []string{"pwd"}, Cwd: "${dst_root}"}, buf, buf)
+	if err != nil {
+		t.Fatalf("pwd:%s", err)
+	}
+	if strings.TrimSpace(buf.String()) != tmpdir {
+		t.Errorf("given %s expect %s", buf.String(), tmpdir)
+	}
+
+	buf.Reset()
+	err = execCommand(f, Command{Args: []string{"cat"}, Stdin: "${dst_root}/in.txt"}, buf, buf)
+	if err != nil {
+		t.Fatalf("cat:%s", err)
+	}
+	if buf.String() != "input" {
+		t.Errorf("given %s expect input", buf.String())
+	}
+
+	// stdin is empty by default.
+	buf.Reset()
+	err = execCommand(f, Command{Args: []string{"cat"}}, buf, buf)
+	if err != nil || buf.Len() != 0 {
+		t.Errorf("cat:%v %s", err, buf.String())
+	}
+}
@@ -0,0 +1,309 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// FormatFromFileName returns the format of a config file from its extension.
+// JSON is the default.
+func FormatFromFileName(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatJSON
+}
+
+// LoadJob decodes a config file in format.
+// YAML and TOML are converted to JSON and decoded as strictly as JSON.
+// Errors are reported at positions of the original file.
+func LoadJob(b []byte, format string) (*Job, error) {
+	var root *configNode
+	var err error
+	switch format {
+	case FormatJSON, "":
+		return DecodeJob(b)
+	case FormatYAML:
+		root, err = parseYAML(b)
+	case FormatTOML:
+		root, err = parseTOML(b)
+	default:
+		return nil, fmt.Errorf("unknown format:%s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	m := &sourceMap{}
+	err = root.encode(buf, m)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(buf.Bytes(), m.position)
+}
+
+// kinds of configNode
+const (
+	nodeScalar = iota
+	nodeArray
+	nodeObject
+)
+
+// configNode is a value of a YAML or TOML config file with its position.
+type configNode struct {
+	line   int
+	column int
+	kind   int
+	value  interface{}   // nodeScalar
+	items  []*configNode // elements of nodeArray or key and value pairs of nodeObject
+}
+
+// sourcePos is a position of the original file where a JSON value starts.
+type sourcePos struct {
+	offset int64
+	line   int
+	column int
+}
+
+// sourceMap maps offsets of converted JSON to positions of the original file.
+type sourceMap []sourcePos
+
+func (m *sourceMap) add(offset int, n *configNode) {
+	*m = append(*m, sourcePos{offset: int64(offset), line: n.line, column: n.column})
+}
+
+// position returns the position of the value which contains offset.
+func (m sourceMap) position(offset int64) (int, int) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].offset > offset })
+	if i == 0 {
+		return 1, 1
+	}
+	return m[i-1].line, m[i-1].column
+}
+
+// encode writes n as JSON and records the positions of values to m.
+func (n *configNode) encode(buf *bytes.Buffer, m *sourceMap) error {
+	m.add(buf.Len(), n)
+	switch n.kind {
+	case nodeArray:
+		buf.WriteString("[")
+		for i, v := range n.items {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			err := v.encode(buf, m)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	case nodeObject:
+		buf.WriteString("{")
+		for i := 0; i+1 < len(n.items); i += 2 {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			key := n.items[i]
+			m.add(buf.Len(), key)
+			b, err := json.Marshal(fmt.Sprint(key.value))
+			if err != nil {
+				return &ConfigError{Line: key.line, Column: key.column, Err: err}
+			}
+			buf.Write(b)
+			buf.WriteString(":")
+			err = n.items[i+1].encode(buf, m)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	default:
+		b, err := json.Marshal(n.value)
+		if err != nil {
+			return &ConfigError{Line: n.line, Column: n.column, Err: err}
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+)`)
+
+func parseYAML(b []byte) (*configNode, error) {
+	doc := &yaml.Node{}
+	err := yaml.Unmarshal(b, doc)
+	if err != nil {
+		// yaml reports only the line in the message.
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, &ConfigError{Line: line, Err: err}
+		}
+		return nil, err
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("config is empty")
+	}
+	return fromYAML(doc.Content[0])
+}
+
+func fromYAML(n *yaml.Node) (*configNode, error) {
+	ret := &configNode{line: n.Line, column: n.Column}
+	switch n.Kind {
+	case yaml.AliasNode:
+		return fromYAML(n.Alias)
+	case yaml.ScalarNode:
+		ret.kind = nodeScalar
+		err := n.Decode(&ret.value)
+		if err != nil {
+			return nil, &ConfigError{Line: n.Line, Column: n.Column, Err: err}
+		}
+	case yaml.SequenceNode:
+		ret.kind = nodeArray
+		for _, v := range n.Content {
+			item, err := fromYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			ret.items = append(ret.items, item)
+		}
+	case yaml.MappingNode:
+		ret.kind = nodeObject
+		pairs := []*configNode{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Tag == "!!merge" {
+				// "<<: *anchor". Keys of the mapping are written first to be overridden.
+				merged, err := mergedYAML(v)
+				if err != nil {
+					return nil, err
+				}
+				pairs = append(merged, pairs...)
+				continue
+			}
+			key, err := fromYAML(k)
+			if err != nil {
+				return nil, err
+			}
+			value, err := fromYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, key, value)
+		}
+		ret.items = pairs
+	default:
+		return nil, &ConfigError{Line: n.Line, Column: n.Column, Err: fmt.Errorf("unsupported yaml node")}
+	}
+	return ret, nil
+}
+
+// mergedYAML returns key and value pairs of a merge key.
+func mergedYAML(n *yaml.Node) ([]*configNode, error) {
+	if n.Kind == yaml.SequenceNode {
+		ret := []*configNode{}
+		for _, v := range n.Content {
+			pairs, err := mergedYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, pairs...)
+		}
+		return ret, nil
+	}
+	merged, err := fromYAML(n)
+	if err != nil {
+		return nil, err
+	}
+	if merged.kind != nodeObject {
+		return nil, &ConfigError{Line: n.Line, Column: n.Column, Err: fmt.Errorf("merge key needs a mapping")}
+	}
+	return merged.items, nil
+}
+
+var tomlPosRe = regexp.MustCompile(`^\((\d+), (\d+)\): (.*)$`)
+
+func parseTOML(b []byte) (*configNode, error) {
+	tree, err := toml.LoadBytes(b)
+	if err != nil {
+		// e.g. "(3, 5): parsing error"
+		if m := tomlPosRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			col, _ := strconv.Atoi(m[2])
+			return nil, &ConfigError{Line: line, Column: col, Err: errors.New(m[3])}
+		}
+		return nil, err
+	}
+	return fromTOMLTree(tree), nil
+}
+
+func fromTOMLTree(t *toml.Tree) *configNode {
+	pos := t.Position()
+	ret := &configNode{line: pos.Line, column: pos.Col, kind: nodeObject}
+	keys := t.Keys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		path := []string{k}
+		pos := t.GetPositionPath(path)
+		key := &configNode{line: pos.Line, column: pos.Col, value: k}
+		ret.items = append(ret.items, key, fromTOMLValue(t.GetPath(path), pos))
+	}
+	return ret
+}
+
+// fromTOMLValue converts v. Elements of arrays don't have positions and pos is used.
+func fromTOMLValue(v interface{}, pos toml.Position) *configNode {
+	switch v := v.(type) {
+	case *toml.Tree:
+		return fromTOMLTree(v)
+	case []*toml.Tree:
+		ret := &configNode{line: pos.Line, column: pos.Col, kind: nodeArray}
+		for _, t := range v {
+			ret.items = append(ret.items, fromTOMLTree(t))
+		}
+		return ret
+	case []interface{}:
+		ret := &configNode{line: pos.Line, column: pos.Col, kind: nodeArray}
+		for _, e := range v {
+			ret.items = append(ret.items, fromTOMLValue(e, pos))
+		}
+		return ret
+	}
+	return &configNode{line: pos.Line, column: pos.Col, value: v}
+}
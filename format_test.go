@@ -0,0 +1,180 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormatFromFileName(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  string
+		expect string
+	}
+
+	cases := []testcase{
+		{"json", "config.json", FormatJSON},
+		{"yaml", "config.yaml", FormatYAML},
+		{"yml", "dir/config.YML", FormatYAML},
+		{"toml", "config.toml", FormatTOML},
+		{"no ext", "config", FormatJSON},
+	}
+
+	for _, v := range cases {
+		ret := FormatFromFileName(v.input)
+		if ret != v.expect {
+			t.Errorf("%s:given %s expect %s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestLoadJobFormats(t *testing.T) {
+	expect := &Job{
+		DstDir: "release/",
+		Srcs: []*SrcFile{
+			{Path: "src/hoge.txt", ChecksumType: ChecksumList{"sha1"}},
+			{Path: "src/a.txt", DstPath: "b.txt", ChecksumType: ChecksumList{"md5", "sha256"}, AfterCmd: Command{Args: []string{"chmod", "644", "${target}"}}},
+		},
+		Manifest: &Manifest{Algorithm: "sha256"},
+		Verify:   true,
+	}
+
+	type testcase struct {
+		name   string
+		format string
+		input  string
+	}
+
+	cases := []testcase{
+		{"json", FormatJSON, `{
+  // comment
+  "srcs": [
+    {"path": "src/hoge.txt", "checksum": "sha1"},
+    {"path": "src/a.txt", "dst_path": "b.txt", "checksum": ["md5", "sha256"], "after_cmd": ["chmod", "644", "${target}"]}
+  ],
+  "dst": "release/",
+  "manifest": {"algorithm": "sha256"},
+  "verify": true
+}`},
+		{"yaml", FormatYAML, `# comment
+srcs:
+  - path: src/hoge.txt
+    checksum: sha1
+  - &a
+    path: src/a.txt
+    dst_path: b.txt
+    checksum: [md5, sha256]
+    after_cmd: [chmod, "644", "${target}"]
+dst: release/
+manifest:
+  algorithm: sha256
+verify: true
+`},
+		{"toml", FormatTOML, `# comment
+dst = "release/"
+verify = true
+
+[[srcs]]
+path = "src/hoge.txt"
+checksum = "sha1"
+
+[[srcs]]
+path = "src/a.txt"
+dst_path = "b.txt"
+checksum = ["md5", "sha256"]
+after_cmd = ["chmod", "644", "${target}"]
+
+[manifest]
+algorithm = "sha256"
+`},
+	}
+
+	for _, v := range cases {
+		j, err := LoadJob([]byte(v.input), v.format)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(j, expect) {
+			t.Errorf("%s:given %+v expect %+v", v.name, j, expect)
+		}
+	}
+}
+
+func TestLoadJobYAMLMerge(t *testing.T) {
+	input := `srcs:
+  - &base
+    path: a
+    checksum: sha1
+    dst_path: bin/
+  - <<: *base
+    path: b
+    dst_path: lib/
+dst: release
+`
+	j, err := LoadJob([]byte(input), FormatYAML)
+	if err != nil {
+		t.Fatalf("LoadJob:%s", err)
+	}
+	expect := &SrcFile{Path: "b", DstPath: "lib/", ChecksumType: ChecksumList{"sha1"}}
+	if len(j.Srcs) != 2 || !reflect.DeepEqual(j.Srcs[1], expect) {
+		t.Errorf("given %+v expect %+v", j.Srcs, expect)
+	}
+}
+
+func TestLoadJobErrors(t *testing.T) {
+	type testcase struct {
+		name   string
+		format string
+		input  string
+		line   int
+		column int
+	}
+
+	cases := []testcase{
+		{"yaml unknown field", FormatYAML, "srcs:\n  - path: a\n    dest: b\ndst: c\n", 3, 5},
+		{"yaml type", FormatYAML, "srcs:\n  - path: a\ndst:\n  - c\n", 4, 3},
+		{"yaml syntax", FormatYAML, "srcs:\n  - path: a\n dst: c\n", 2, 0},
+		{"yaml checksum type", FormatYAML, "srcs:\n  - path: a\n    checksum: 5\n", 3, 15},
+		{"yaml before_cmd type", FormatYAML, "srcs:\n  - path: a\n    before_cmd: 5\n", 3, 17},
+		{"yaml timeout type", FormatYAML, "srcs:\n  - path: a\n    after_cmd:\n      cmd: ls\n      timeout: true\n", 5, 16},
+		{"toml checksum type", FormatTOML, "dst = \"c\"\n\n[[srcs]]\npath = \"a\"\nchecksum = 5\n", 5, 1},
+		{"toml unknown field", FormatTOML, "dst = \"c\"\n\n[[srcs]]\npath = \"a\"\ndest = \"b\"\n", 5, 1},
+		{"toml type", FormatTOML, "dst = 1\n\n[[srcs]]\npath = \"a\"\n", 1, 1},
+		{"toml syntax", FormatTOML, "dst = \"c\"\n[[srcs]\n", 2, 7},
+	}
+
+	for _, v := range cases {
+		_, err := LoadJob([]byte(v.input), v.format)
+		var cerr *ConfigError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%s:not ConfigError %v", v.name, err)
+			continue
+		}
+		if cerr.Line != v.line || cerr.Column != v.column {
+			t.Errorf("%s:given %d:%d expect %d:%d %s", v.name, cerr.Line, cerr.Column, v.line, v.column, err)
+		}
+	}
+
+	_, err := LoadJob([]byte{}, "xml")
+	if err == nil {
+		t.Errorf("unknown format should be error")
+	}
+}
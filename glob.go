@@ -0,0 +1,135 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HasMeta reports whether p contains any glob meta characters.
+func HasMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// GlobBase returns the leading directory of pattern which has no meta characters.
+// e.g. "build/**/*.so" -> "build"
+func GlobBase(pattern string) string {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	base := []string{}
+	for i, v := range elems {
+		if HasMeta(v) || i == len(elems)-1 {
+			break
+		}
+		base = append(base, v)
+	}
+	if len(base) == 0 {
+		return "."
+	}
+	if len(base) == 1 && base[0] == "" {
+		return "/"
+	}
+	return filepath.FromSlash(strings.Join(base, "/"))
+}
+
+// MatchGlob reports whether name matches pattern.
+// Both are slash separated. "**" matches zero or more path elements.
+func MatchGlob(pattern string, name string) (bool, error) {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern []string, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// skip redundant "**"
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchElems(pattern[1:], name[i:])
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// ExpandGlob returns regular files which match pattern in lexical order.
+func ExpandGlob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		ret := []string{}
+		for _, v := range matches {
+			info, err := os.Stat(v)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+
+	// validate pattern before walking
+	if _, err := MatchGlob(filepath.ToSlash(pattern), ""); err != nil {
+		return nil, err
+	}
+
+	base := GlobBase(pattern)
+	ret := []string{}
+	err := filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == base && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ok, err := MatchGlob(filepath.ToSlash(filepath.Clean(pattern)), filepath.ToSlash(p))
+		if err != nil {
+			return err
+		}
+		if ok {
+			ret = append(ret, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
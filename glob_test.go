@@ -0,0 +1,129 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobBase(t *testing.T) {
+	type testcase struct {
+		name    string
+		pattern string
+		expect  string
+	}
+
+	cases := []testcase{
+		{"no dir", "*.txt", "."},
+		{"single dir", "build/*.so", "build"},
+		{"recursive", "build/**/*.so", "build"},
+		{"meta in dir", "build/v*/a.so", "build"},
+		{"absolute", "/tmp/*.so", "/tmp"},
+	}
+
+	for _, v := range cases {
+		ret := GlobBase(v.pattern)
+		if ret != filepath.FromSlash(v.expect) {
+			t.Errorf("%s:given %s expect %s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	type testcase struct {
+		name    string
+		pattern string
+		path    string
+		expect  bool
+	}
+
+	cases := []testcase{
+		{"simple", "*.txt", "a.txt", true},
+		{"simple mismatch", "*.txt", "a.md", false},
+		{"no cross dir", "*.txt", "dir/a.txt", false},
+		{"recursive zero", "**/*.txt", "a.txt", true},
+		{"recursive", "**/*.txt", "a/b/c.txt", true},
+		{"recursive middle", "a/**/c.txt", "a/b/d/c.txt", true},
+		{"recursive middle zero", "a/**/c.txt", "a/c.txt", true},
+		{"recursive tail", "a/**", "a/b/c.txt", true},
+		{"recursive mismatch", "a/**/c.txt", "b/c.txt", false},
+	}
+
+	for _, v := range cases {
+		ret, err := MatchGlob(v.pattern, v.path)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if ret != v.expect {
+			t.Errorf("%s:given %t expect %t", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "expandglob")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := []string{"a.txt", "b.txt", "c.md", "sub/d.txt", "sub/deep/e.txt"}
+	for _, v := range files {
+		p := filepath.Join(tmpdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	type testcase struct {
+		name    string
+		pattern string
+		expect  []string
+	}
+
+	cases := []testcase{
+		{"single level", "*.txt", []string{"a.txt", "b.txt"}},
+		{"recursive", "**/*.txt", []string{"a.txt", "b.txt", "sub/d.txt", "sub/deep/e.txt"}},
+		{"sub dir", "sub/**/*.txt", []string{"sub/d.txt", "sub/deep/e.txt"}},
+		{"no match", "*.go", []string{}},
+		{"dir is not matched", "su*", []string{}},
+	}
+
+	for _, v := range cases {
+		ret, err := ExpandGlob(filepath.Join(tmpdir, v.pattern))
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s:given %v expect %v", v.name, ret, v.expect)
+			continue
+		}
+		for i := range ret {
+			if ret[i] != filepath.Join(tmpdir, v.expect[i]) {
+				t.Errorf("%s:given %s expect %s", v.name, ret[i], v.expect[i])
+			}
+		}
+	}
+}
@@ -1,3 +1,10 @@
 module github.com/nokute78/file-collector
 
 go 1.14
+
+require (
+	github.com/pelletier/go-toml v1.9.5
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,185 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StderrTailLines is the number of lines of stderr in an error of a failed command.
+const StderrTailLines = 10
+
+// prefixWriter writes each line with a prefix.
+// mu is shared among writers to the same output.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte // incomplete line
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		n := bytes.IndexByte(p.buf, '\n')
+		if n < 0 {
+			return len(b), nil
+		}
+		err := p.writeLine(p.buf[:n+1])
+		p.buf = p.buf[n+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+	return err
+}
+
+// Flush writes the incomplete line.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+	return err
+}
+
+// lockedWriter serializes writes from stdout and stderr.
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
+
+// tailWriter keeps the last n lines.
+type tailWriter struct {
+	n     int
+	lines []string
+	buf   []byte // incomplete line
+}
+
+func (t *tailWriter) Write(b []byte) (int, error) {
+	t.buf = append(t.buf, b...)
+	for {
+		n := bytes.IndexByte(t.buf, '\n')
+		if n < 0 {
+			return len(b), nil
+		}
+		t.add(string(t.buf[:n]))
+		t.buf = t.buf[n+1:]
+	}
+}
+
+func (t *tailWriter) add(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.n {
+		t.lines = t.lines[len(t.lines)-t.n:]
+	}
+}
+
+// Lines returns the last lines including the incomplete line.
+func (t *tailWriter) Lines() []string {
+	ret := append([]string{}, t.lines...)
+	if len(t.buf) > 0 {
+		ret = append(ret, string(t.buf))
+		if len(ret) > t.n {
+			ret = ret[len(ret)-t.n:]
+		}
+	}
+	return ret
+}
+
+// hookOutput is where output of hooks of a source goes.
+// stdout and stderr are nil if output is discarded.
+type hookOutput struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	prefixes []*prefixWriter
+	log      *os.File
+}
+
+// newHookOutput writes lines to out and errw with prefix and both of them to logPath.
+// Writers and logPath may be blank.
+func newHookOutput(prefix string, out io.Writer, errw io.Writer, logPath string) (*hookOutput, error) {
+	ret := &hookOutput{}
+	mu := &sync.Mutex{}
+	outs := []io.Writer{}
+	errs := []io.Writer{}
+	if out != nil {
+		p := &prefixWriter{w: out, prefix: prefix, mu: mu}
+		ret.prefixes = append(ret.prefixes, p)
+		outs = append(outs, p)
+	}
+	if errw != nil {
+		p := &prefixWriter{w: errw, prefix: prefix, mu: mu}
+		ret.prefixes = append(ret.prefixes, p)
+		errs = append(errs, p)
+	}
+	if logPath != "" {
+		err := os.MkdirAll(filepath.Dir(logPath), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("log:%w", err)
+		}
+		ret.log, err = os.Create(logPath)
+		if err != nil {
+			return nil, fmt.Errorf("log:%w", err)
+		}
+		l := &lockedWriter{w: ret.log, mu: mu}
+		outs = append(outs, l)
+		errs = append(errs, l)
+	}
+
+	if len(outs) > 0 {
+		ret.stdout = io.MultiWriter(outs...)
+	}
+	if len(errs) > 0 {
+		ret.stderr = io.MultiWriter(errs...)
+	}
+	return ret, nil
+}
+
+// Close flushes incomplete lines and closes the log file.
+func (h *hookOutput) Close() error {
+	var ret error
+	for _, v := range h.prefixes {
+		if err := v.Flush(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	if h.log != nil {
+		if err := h.log.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
@@ -0,0 +1,141 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  []string
+		expect string
+	}
+
+	cases := []testcase{
+		{"line", []string{"a\n"}, "[x] a\n"},
+		{"lines", []string{"a\nb\n"}, "[x] a\n[x] b\n"},
+		{"split", []string{"a", "b\nc", "\n"}, "[x] ab\n[x] c\n"},
+		{"incomplete", []string{"a\nb"}, "[x] a\n[x] b\n"},
+	}
+
+	for _, v := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		p := &prefixWriter{w: buf, prefix: "[x] ", mu: &sync.Mutex{}}
+		for _, s := range v.input {
+			_, err := p.Write([]byte(s))
+			if err != nil {
+				t.Errorf("%s:%s", v.name, err)
+			}
+		}
+		err := p.Flush()
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s:given %q expect %q", v.name, buf.String(), v.expect)
+		}
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  string
+		expect []string
+	}
+
+	cases := []testcase{
+		{"empty", "", []string{}},
+		{"short", "a\nb\n", []string{"a", "b"}},
+		{"long", "1\n2\n3\n4\n5\n", []string{"3", "4", "5"}},
+		{"incomplete", "1\n2\n3\n4", []string{"2", "3", "4"}},
+	}
+
+	for _, v := range cases {
+		tail := &tailWriter{n: 3}
+		_, err := tail.Write([]byte(v.input))
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		}
+		if !reflect.DeepEqual(tail.Lines(), v.expect) {
+			t.Errorf("%s:given %v expect %v", v.name, tail.Lines(), v.expect)
+		}
+	}
+}
+
+func TestJobHookOutput(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "hookoutput")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	logDir := filepath.Join(tmpdir, "logs")
+	j := &Job{DstDir: filepath.Join(tmpdir, "release"), LogDir: logDir, Srcs: []*SrcFile{{Path: src, DstPath: "sub/",
+		BeforeCmd: Command{Args: []string{"echo before; echo warning >&2"}, Shell: true},
+		AfterCmd:  Command{Args: []string{"echo", "after"}}}}}
+
+	out := bytes.NewBuffer([]byte{})
+	errout := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(out, errout)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s", err)
+	}
+	prefix := "[" + src + "] "
+	if out.String() != prefix+"before\n"+prefix+"after\n" {
+		t.Errorf("stdout:given %q", out.String())
+	}
+	if errout.String() != prefix+"warning\n" {
+		t.Errorf("stderr:given %q", errout.String())
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(logDir, "sub", "a.txt.log"))
+	if err != nil {
+		t.Fatalf("ReadFile:%s", err)
+	}
+	for _, v := range []string{"before\n", "warning\n", "after\n"} {
+		if !strings.Contains(string(b), v) {
+			t.Errorf("log:%s is missing in %q", v, string(b))
+		}
+	}
+
+	// stderr of the failed command is in the error.
+	j.DstDir = filepath.Join(tmpdir, "release2")
+	j.Srcs[0].AfterCmd = Command{Args: []string{"for i in 1 2 3 4 5 6 7 8 9 10 11 12; do echo line$i >&2; done; exit 3"}, Shell: true}
+	err = j.CopyAndExec(ioutil.Discard, ioutil.Discard)
+	if err == nil {
+		t.Fatalf("it should be error")
+	}
+	if !strings.Contains(err.Error(), "exit code:3") || !strings.Contains(err.Error(), "line3\n  line4") || strings.Contains(err.Error(), "line2\n") {
+		t.Errorf("given %s", err)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ignoreRule is a .gitignore style pattern.
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreList is a list of .gitignore style patterns.
+// The last matched pattern wins like .gitignore.
+type IgnoreList struct {
+	rules []ignoreRule
+}
+
+// NewIgnoreList parses patterns.
+// Blank patterns and comments beginning with "#" are ignored.
+func NewIgnoreList(patterns []string) (*IgnoreList, error) {
+	l := &IgnoreList{}
+	for _, v := range patterns {
+		err := l.Add(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// LoadIgnoreFile reads a .gitignore style file.
+func LoadIgnoreFile(path string) (*IgnoreList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &IgnoreList{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		err = l.Add(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d:%w", path, line, err)
+		}
+	}
+	return l, scanner.Err()
+}
+
+// Add appends a pattern.
+func (l *IgnoreList) Add(pattern string) error {
+	p := strings.TrimRight(pattern, " \t\r")
+	if p == "" || p[0] == '#' {
+		return nil
+	}
+
+	rule := ignoreRule{}
+	if p[0] == '!' {
+		rule.negate = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		rule.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if strings.HasPrefix(p, "/") {
+		p = p[1:]
+	} else if !strings.Contains(p, "/") {
+		// a pattern without slash matches at any level.
+		p = "**/" + p
+	}
+	if p == "" {
+		return fmt.Errorf("invalid pattern %q", pattern)
+	}
+
+	// validate pattern
+	_, err := MatchGlob(p, "")
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q:%w", pattern, err)
+	}
+
+	rule.pattern = p
+	l.rules = append(l.rules, rule)
+	return nil
+}
+
+// Merge appends rules of other.
+func (l *IgnoreList) Merge(other *IgnoreList) {
+	l.rules = append(l.rules, other.rules...)
+}
+
+// Len returns the number of patterns.
+func (l *IgnoreList) Len() int {
+	return len(l.rules)
+}
+
+// Match reports whether rel is matched.
+// rel is a slash separated relative path.
+func (l *IgnoreList) Match(rel string, isDir bool) bool {
+	ret := false
+	for _, v := range l.rules {
+		if v.dirOnly && !isDir {
+			continue
+		}
+		ok, _ := MatchGlob(v.pattern, rel)
+		if ok {
+			ret = !v.negate
+		}
+	}
+	return ret
+}
+
+// MatchPath reports whether rel or one of its parent directories is matched.
+// rel is a slash separated relative path of a file.
+func (l *IgnoreList) MatchPath(rel string) bool {
+	elems := strings.Split(rel, "/")
+	for i := 1; i < len(elems); i++ {
+		if l.Match(strings.Join(elems[:i], "/"), true) {
+			return true
+		}
+	}
+	return l.Match(rel, false)
+}
@@ -0,0 +1,99 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestIgnoreListMatch(t *testing.T) {
+	type testcase struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		expect   bool
+	}
+
+	cases := []testcase{
+		{"basename", []string{"*.map"}, "js/app.js.map", false, true},
+		{"basename mismatch", []string{"*.map"}, "js/app.js", false, false},
+		{"dir only", []string{"node_modules/"}, "node_modules", true, true},
+		{"dir only file", []string{"node_modules/"}, "node_modules", false, false},
+		{"anchored", []string{"/a.txt"}, "a.txt", false, true},
+		{"anchored sub", []string{"/a.txt"}, "sub/a.txt", false, false},
+		{"with slash", []string{"doc/*.md"}, "doc/a.md", false, true},
+		{"with slash sub", []string{"doc/*.md"}, "sub/doc/a.md", false, false},
+		{"negate", []string{"*.txt", "!keep.txt"}, "keep.txt", false, false},
+		{"negate other", []string{"*.txt", "!keep.txt"}, "drop.txt", false, true},
+		{"comment", []string{"# *.txt", ""}, "a.txt", false, false},
+	}
+
+	for _, v := range cases {
+		l, err := NewIgnoreList(v.patterns)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		ret := l.Match(v.path, v.isDir)
+		if ret != v.expect {
+			t.Errorf("%s:given %t expect %t", v.name, ret, v.expect)
+		}
+	}
+
+	_, err := NewIgnoreList([]string{"[a"})
+	if err == nil {
+		t.Errorf("invalid pattern should be error")
+	}
+}
+
+func TestIgnoreListMatchPath(t *testing.T) {
+	l, err := NewIgnoreList([]string{"node_modules/"})
+	if err != nil {
+		t.Fatalf("NewIgnoreList:%s", err)
+	}
+	if !l.MatchPath("node_modules/a/b.js") {
+		t.Errorf("file under ignored dir should be matched")
+	}
+	if l.MatchPath("src/b.js") {
+		t.Errorf("src/b.js should not be matched")
+	}
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "ignorefile")
+	if err != nil {
+		t.Fatalf("TempFile:%s", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("# comment\n*.map\n\nnode_modules/\n")
+	f.Close()
+	if err != nil {
+		t.Fatalf("WriteString:%s", err)
+	}
+
+	l, err := LoadIgnoreFile(f.Name())
+	if err != nil {
+		t.Fatalf("LoadIgnoreFile:%s", err)
+	}
+	if l.Len() != 2 {
+		t.Errorf("given %d rules expect 2", l.Len())
+	}
+}
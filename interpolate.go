@@ -0,0 +1,237 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// placeholderNames are replaced when commands are executed. Interpolation keeps them as is.
+var placeholderNames = map[string]bool{
+	"target":   true,
+	"src":      true,
+	"dst":      true,
+	"basename": true,
+	"dirname":  true,
+	"ext":      true,
+	"checksum": true,
+	"dst_root": true,
+	"job_name": true,
+	"error":    true,
+}
+
+var varNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// variables resolves "${env:NAME}" and "${NAME}" of vars.
+// "${NAME:-default}" is replaced with default if NAME is undefined.
+type variables struct {
+	vars      map[string]string
+	resolved  map[string]string
+	resolving map[string]bool // to detect a loop of vars
+}
+
+func newVariables(vars map[string]string) *variables {
+	return &variables{vars: vars, resolved: make(map[string]string), resolving: make(map[string]bool)}
+}
+
+// Interpolate replaces variables in s. "$${" is an escaped "${".
+func Interpolate(s string, vars map[string]string) (string, error) {
+	return newVariables(vars).expand(s)
+}
+
+// lookup returns the value of a variable. Values of vars may have variables.
+func (v *variables) lookup(name string) (string, bool, error) {
+	if strings.HasPrefix(name, "env:") {
+		ret, ok := os.LookupEnv(strings.TrimPrefix(name, "env:"))
+		return ret, ok, nil
+	}
+	if ret, ok := v.resolved[name]; ok {
+		return ret, true, nil
+	}
+	raw, ok := v.vars[name]
+	if !ok {
+		return "", false, nil
+	}
+	if v.resolving[name] {
+		return "", false, fmt.Errorf("variable %s refers to itself", name)
+	}
+	v.resolving[name] = true
+	ret, err := v.expand(raw)
+	delete(v.resolving, name)
+	if err != nil {
+		return "", false, err
+	}
+	v.resolved[name] = ret
+	return ret, true, nil
+}
+
+func (v *variables) expand(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// "$${" -> "${"
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("%s: } is missing", s[i:])
+		}
+		expr := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		if placeholderNames[expr] {
+			b.WriteString("${" + expr + "}")
+			continue
+		}
+
+		name, def, hasDefault := expr, "", false
+		if n := strings.Index(expr, ":-"); n >= 0 {
+			name, def, hasDefault = expr[:n], expr[n+2:], true
+		}
+		if !varNameRe.MatchString(strings.TrimPrefix(name, "env:")) {
+			return "", fmt.Errorf("invalid variable name:%s", name)
+		}
+
+		value, ok, err := v.lookup(name)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			if !hasDefault {
+				return "", fmt.Errorf("undefined variable:%s", name)
+			}
+			value = def
+		}
+		b.WriteString(value)
+	}
+}
+
+// expandAll returns a copy of args whose variables are replaced.
+func (v *variables) expandAll(args []string) ([]string, error) {
+	if args == nil {
+		return nil, nil
+	}
+	ret := make([]string, len(args))
+	for i, a := range args {
+		s, err := v.expand(a)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = s
+	}
+	return ret, nil
+}
+
+// expandCommand returns a copy of c whose variables are replaced.
+func (v *variables) expandCommand(c Command) (Command, error) {
+	ret := c
+	var err error
+	ret.Args, err = v.expandAll(c.Args)
+	if err != nil {
+		return ret, err
+	}
+	ret.Cwd, err = v.expand(c.Cwd)
+	if err != nil {
+		return ret, fmt.Errorf("cwd:%w", err)
+	}
+	ret.Stdin, err = v.expand(c.Stdin)
+	if err != nil {
+		return ret, fmt.Errorf("stdin:%w", err)
+	}
+	if c.Env != nil {
+		ret.Env = make(map[string]string)
+		for k, e := range c.Env {
+			ret.Env[k], err = v.expand(e)
+			if err != nil {
+				return ret, fmt.Errorf("env %s:%w", k, err)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Interpolate returns a copy of j whose variables are replaced.
+// path, dst_path, dst, log_dir and commands are interpolated.
+func (j Job) Interpolate() (*Job, error) {
+	for k := range j.Vars {
+		if !varNameRe.MatchString(k) || placeholderNames[k] {
+			return nil, fmt.Errorf("vars: invalid name %s", k)
+		}
+	}
+
+	v := newVariables(j.Vars)
+	ret := j
+	var err error
+	ret.DstDir, err = v.expand(j.DstDir)
+	if err != nil {
+		return nil, fmt.Errorf("dst:%w", err)
+	}
+	ret.LogDir, err = v.expand(j.LogDir)
+	if err != nil {
+		return nil, fmt.Errorf("log_dir:%w", err)
+	}
+	for _, c := range []struct {
+		name string
+		cmd  *Command
+	}{
+		{"before_cmd", &ret.BeforeCmd},
+		{"after_cmd", &ret.AfterCmd},
+		{"on_success", &ret.OnSuccess},
+		{"on_failure", &ret.OnFailure},
+		{"finally", &ret.Finally},
+	} {
+		*c.cmd, err = v.expandCommand(*c.cmd)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", c.name, err)
+		}
+	}
+
+	ret.Srcs = make([]*SrcFile, len(j.Srcs))
+	for i, src := range j.Srcs {
+		s := *src
+		s.Path, err = v.expand(src.Path)
+		if err != nil {
+			return nil, fmt.Errorf("srcs[%d] path:%w", i, err)
+		}
+		s.DstPath, err = v.expand(src.DstPath)
+		if err != nil {
+			return nil, fmt.Errorf("srcs[%d] dst_path:%w", i, err)
+		}
+		s.BeforeCmd, err = v.expandCommand(src.BeforeCmd)
+		if err != nil {
+			return nil, fmt.Errorf("srcs[%d] before_cmd:%w", i, err)
+		}
+		s.AfterCmd, err = v.expandCommand(src.AfterCmd)
+		if err != nil {
+			return nil, fmt.Errorf("srcs[%d] after_cmd:%w", i, err)
+		}
+		ret.Srcs[i] = &s
+	}
+	return &ret, nil
+}
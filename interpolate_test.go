@@ -0,0 +1,110 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	err := os.Setenv("FC_TEST_VERSION", "1.2.3")
+	if err != nil {
+		t.Fatalf("Setenv:%s", err)
+	}
+	defer os.Unsetenv("FC_TEST_VERSION")
+	os.Unsetenv("FC_TEST_UNDEFINED")
+
+	vars := map[string]string{
+		"NAME":    "app",
+		"VERSION": "${env:FC_TEST_VERSION}",
+		"FILE":    "${NAME}-${VERSION}",
+		"LOOP":    "${LOOP2}",
+		"LOOP2":   "${LOOP}",
+	}
+
+	type testcase struct {
+		name    string
+		input   string
+		expect  string
+		success bool
+	}
+
+	cases := []testcase{
+		{"no variable", "a.txt", "a.txt", true},
+		{"env", "app-${env:FC_TEST_VERSION}.tar.gz", "app-1.2.3.tar.gz", true},
+		{"vars", "${NAME}.tar.gz", "app.tar.gz", true},
+		{"nested vars", "build/${FILE}.tar.gz", "build/app-1.2.3.tar.gz", true},
+		{"default", "${UNDEFINED:-dev}/${NAME:-x}", "dev/app", true},
+		{"env default", "${env:FC_TEST_UNDEFINED:-dev}", "dev", true},
+		{"empty default", "a${UNDEFINED:-}b", "ab", true},
+		{"placeholder", "${target}", "${target}", true},
+		{"escape", "$${NAME}", "${NAME}", true},
+		{"undefined", "${UNDEFINED}", "", false},
+		{"undefined env", "${env:FC_TEST_UNDEFINED}", "", false},
+		{"not closed", "${NAME", "", false},
+		{"invalid name", "${NA ME}", "", false},
+		{"loop", "${LOOP}", "", false},
+	}
+
+	for _, v := range cases {
+		ret, err := Interpolate(v.input, vars)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error. given %s", v.name, ret)
+		} else if ret != v.expect {
+			t.Errorf("%s:given %s expect %s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestJobInterpolate(t *testing.T) {
+	j := &Job{
+		DstDir:   "release/${VERSION}",
+		AfterCmd: Command{Args: []string{"echo", "${VERSION}"}},
+		Vars:     map[string]string{"VERSION": "${env:FC_TEST_UNDEFINED:-dev}"},
+		Srcs: []*SrcFile{{Path: "build/app-${VERSION}.tar.gz", DstPath: "${VERSION}/",
+			BeforeCmd: Command{Args: []string{"test", "-f", "${target}"}}, AfterCmd: Command{Args: []string{"echo", "${VERSION}"}}}},
+	}
+	os.Unsetenv("FC_TEST_UNDEFINED")
+
+	ret, err := j.Interpolate()
+	if err != nil {
+		t.Fatalf("Interpolate:%s", err)
+	}
+	expect := &Job{
+		DstDir:   "release/dev",
+		AfterCmd: Command{Args: []string{"echo", "dev"}},
+		Vars:     j.Vars,
+		Srcs: []*SrcFile{{Path: "build/app-dev.tar.gz", DstPath: "dev/",
+			BeforeCmd: Command{Args: []string{"test", "-f", "${target}"}}, AfterCmd: Command{Args: []string{"echo", "dev"}}}},
+	}
+	if !reflect.DeepEqual(ret, expect) {
+		t.Errorf("given %+v expect %+v", ret, expect)
+	}
+	if j.Srcs[0].Path != "build/app-${VERSION}.tar.gz" {
+		t.Errorf("configured src is modified:%s", j.Srcs[0].Path)
+	}
+
+	j.Vars["target"] = "x"
+	_, err = j.Interpolate()
+	if err == nil {
+		t.Errorf("a placeholder name should not be a variable")
+	}
+}
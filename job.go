@@ -22,18 +22,77 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Job struct {
-	Srcs     []*SrcFile `json:"srcs"`
-	DstDir   string     `json:"dst"`
-	AfterCmd []string   `json:"after_cmd",omitempty`
+	Name        string            `json:"name,omitempty"` // for ${job_name}. default: base name of dst
+	Srcs        []*SrcFile        `json:"srcs"`
+	DstDir      string            `json:"dst"`
+	BeforeCmd   Command           `json:"before_cmd,omitempty"`
+	AfterCmd    Command           `json:"after_cmd,omitempty"`
+	OnSuccess   Command           `json:"on_success,omitempty"` // executed after publishing
+	OnFailure   Command           `json:"on_failure,omitempty"` // executed if the job fails
+	Finally     Command           `json:"finally,omitempty"`    // always executed at last
+	Manifest    *Manifest         `json:"manifest,omitempty"`
+	Verify      bool              `json:"verify,omitempty"`       // verify all sources after copying
+	Preserve    []string          `json:"preserve,omitempty"`     // default of srcs
+	Symlinks    string            `json:"symlinks,omitempty"`     // default of srcs
+	SymlinkRoot string            `json:"symlink_root,omitempty"` // default of srcs
+	Staging     string            `json:"staging,omitempty"`      // directory to stage files. default: parent of dst
+	OnExisting  string            `json:"on_existing,omitempty"`  // fail(default), replace, backup or merge
+	Incremental *Incremental      `json:"incremental,omitempty"`  // copy only changed files
+	Vars        map[string]string `json:"vars,omitempty"`         // variables for "${NAME}"
+	LogDir      string            `json:"log_dir,omitempty"`      // write output of hooks of each src to log files
+	Parallelism int               `json:"parallelism,omitempty"`  // number of srcs copied concurrently. default: 1
+	SerialHooks *bool             `json:"serial_hooks,omitempty"` // execute hooks of srcs one at a time. default: true
+}
+
+// UnmarshalJSON decodes the object strictly and reports positions of errors.
+func (j *Job) UnmarshalJSON(b []byte) error {
+	return decodeObject(b, j)
 }
 
 func (j Job) CheckConfiguration() error {
 	if len(j.Srcs) == 0 {
 		return fmt.Errorf("Srcs missing")
 	}
+	if j.Manifest != nil {
+		err := j.Manifest.CheckConfiguration()
+		if err != nil {
+			return err
+		}
+	}
+	err := CheckPreserve(j.Preserve)
+	if err != nil {
+		return err
+	}
+	err = CheckSymlinkPolicy(j.Symlinks)
+	if err != nil {
+		return err
+	}
+	err = CheckOnExisting(j.OnExisting)
+	if err != nil {
+		return err
+	}
+	if j.Incremental != nil {
+		err = j.Incremental.CheckConfiguration()
+		if err != nil {
+			return err
+		}
+		if j.OnExisting != "" && j.OnExisting != OnExistingMerge {
+			return fmt.Errorf("on_existing %q can't be used with incremental", j.OnExisting)
+		}
+	}
+	if j.Parallelism < 0 {
+		return fmt.Errorf("parallelism must not be negative")
+	}
+	for _, c := range []Command{j.BeforeCmd, j.AfterCmd, j.OnSuccess, j.OnFailure, j.Finally} {
+		err = c.CheckConfiguration()
+		if err != nil {
+			return err
+		}
+	}
 	/*
 		outrootinfo, err := os.Stat(j.DstDir)
 		if err != nil {
@@ -46,42 +105,270 @@ func (j Job) CheckConfiguration() error {
 	return nil
 }
 
+// Expand applies job level defaults to srcs and expands them into files.
+// j.Srcs are not modified.
+func (j Job) Expand() ([]*SrcFile, error) {
+	srcs := []*SrcFile{}
+	for _, v := range j.Srcs {
+		src := *v
+		if src.Symlinks == "" {
+			src.Symlinks = j.Symlinks
+		}
+		if src.SymlinkRoot == "" {
+			src.SymlinkRoot = j.SymlinkRoot
+		}
+		if src.Preserve == nil {
+			src.Preserve = j.Preserve
+		}
+		src.Verify = src.Verify || j.Verify
+		src.jobName = j.name()
+		src.logDir = j.LogDir
+		if j.Incremental != nil && j.Incremental.compare() == CompareSizeMtime {
+			// mtime of dst is compared with src next time.
+			src.Preserve = append(append([]string{}, src.preserveList()...), PreserveTimestamps)
+		}
+
+		expanded, err := src.Expand()
+		if err != nil {
+			return nil, fmt.Errorf("%s error:%s", v.Path, err)
+		}
+		srcs = append(srcs, expanded...)
+	}
+	return srcs, nil
+}
+
 func (j Job) CopyAndExec(cmdout io.Writer, cmderr io.Writer) error {
-	err := j.CheckConfiguration()
+	_, err := j.run(cmdout, cmderr)
+	return err
+}
+
+func (j Job) run(cmdout io.Writer, cmderr io.Writer) (*SyncStats, error) {
+	resolved, err := j.Interpolate()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	j = *resolved
+
+	dst := filepath.Clean(j.DstDir)
+	err = j.CheckConfiguration()
+	if err != nil {
+		// hooks of the failure run unless they are invalid themselves.
+		for _, c := range []Command{j.OnFailure, j.Finally} {
+			if c.CheckConfiguration() != nil {
+				return nil, err
+			}
+		}
+		return nil, j.finish(err, "", dst, cmdout, cmderr)
+	}
+
+	st := &collectState{}
+	defer func() {
+		if st.tmpdir != "" {
+			os.RemoveAll(st.tmpdir)
+		}
+	}()
+	stats, err := j.collect(dst, st, cmdout, cmderr)
+
+	// the staging directory is kept until hooks finish.
+	err = j.finish(err, st.root, dst, cmdout, cmderr)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// collectState is where files of a job are.
+type collectState struct {
+	tmpdir string // staging directory to remove later
+	root   string // root of collected files. dst after publishing
+}
+
+// collect copies srcs into a staging directory and publishes it to dst.
+// st is updated to remove the staging directory later.
+func (j Job) collect(dst string, st *collectState, cmdout io.Writer, cmderr io.Writer) (*SyncStats, error) {
+	// incremental sync always merges into dst.
+	onExisting := j.OnExisting
+	if j.Incremental != nil {
+		onExisting = OnExistingMerge
+	}
+	if onExisting == "" || onExisting == OnExistingFail {
+		ok, err := exists(dst)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return nil, fmt.Errorf("%s already exists", dst)
+		}
 	}
 
-	tmpdir, err := ioutil.TempDir("", "job")
+	// stage next to dst by default not to copy across file systems on publishing.
+	staging := j.Staging
+	if staging == "" {
+		staging = filepath.Dir(dst)
+	}
+	err := os.MkdirAll(staging, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("Job.CopyAndExec MkdirAll:%w", err)
+	}
+	st.tmpdir, err = ioutil.TempDir(staging, "."+filepath.Base(dst)+".staging")
 	if err != nil {
-		return fmt.Errorf("Job.CopyAndExec Tempdir:%w", err)
+		return nil, fmt.Errorf("Job.CopyAndExec Tempdir:%w", err)
 	}
-	defer os.RemoveAll(tmpdir)
-	tmproot := filepath.Join(tmpdir, "root")
+	tmproot := filepath.Join(st.tmpdir, "root")
 	err = os.Mkdir(tmproot, 0744)
 	if err != nil {
-		return fmt.Errorf("Job.CopyAndExec Mkdir:%w", err)
+		return nil, fmt.Errorf("Job.CopyAndExec Mkdir:%w", err)
 	}
+	st.root = tmproot
 
-	for _, v := range j.Srcs {
-		err = v.CopyAndExec(tmproot)
+	if !j.BeforeCmd.IsEmpty() {
+		err = execCommand(j.placeholders(tmproot, dst), j.BeforeCmd, cmdout, cmderr)
 		if err != nil {
-			return fmt.Errorf("%s error:%s", v.Path, err)
+			return nil, fmt.Errorf("before_cmd:%w", err)
 		}
 	}
 
-	if len(j.AfterCmd) > 1 {
-		mp := make(map[string]string)
-		err = execCommand(mp, j.AfterCmd, cmdout, cmderr)
+	srcs, err := j.Expand()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := j.copySrcs(srcs, tmproot, dst, cmdout, cmderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Manifest != nil {
+		err = j.writeManifest(tmproot, srcs)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	if !j.AfterCmd.IsEmpty() {
+		err = execCommand(j.placeholders(tmproot, dst), j.AfterCmd, cmdout, cmderr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = PublishTo(tmproot, dst, onExisting)
+	if err != nil {
+		return nil, fmt.Errorf("Publish:%w", err)
+	}
+	st.root = dst
+
+	if j.Incremental != nil {
+		if j.Incremental.Delete {
+			keep, err := j.listed(srcs)
+			if err != nil {
+				return nil, err
+			}
+			stats.Deleted, err = DeleteUnlisted(dst, keep)
+			if err != nil {
+				return nil, fmt.Errorf("delete:%w", err)
+			}
 		}
+		stats.Print(cmdout)
 	}
 
-	err = os.Rename(tmproot, j.DstDir)
+	return stats, nil
+}
+
+// finish executes on_success or on_failure according to err, and then finally.
+// root is the staging directory, dst after publishing or blank before staging.
+// It returns err with errors of the hooks.
+// A failure of on_success fails the job but on_failure is not executed.
+func (j Job) finish(err error, root string, dst string, cmdout io.Writer, cmderr io.Writer) error {
+	mp := j.placeholders(root, dst)
+	mp["${error}"] = ""
 	if err != nil {
-		return fmt.Errorf("Rename:%w", err)
+		mp["${error}"] = strings.TrimSpace(err.Error())
+	}
+
+	if err == nil && !j.OnSuccess.IsEmpty() {
+		herr := execCommand(mp, j.OnSuccess, cmdout, cmderr)
+		if herr != nil {
+			err = fmt.Errorf("on_success:%w", herr)
+			mp["${error}"] = strings.TrimSpace(err.Error())
+		}
+	} else if err != nil && !j.OnFailure.IsEmpty() {
+		herr := execCommand(mp, j.OnFailure, cmdout, cmderr)
+		if herr != nil {
+			err = fmt.Errorf("%s\non_failure:%s", err, herr)
+		}
 	}
 
+	if !j.Finally.IsEmpty() {
+		herr := execCommand(mp, j.Finally, cmdout, cmderr)
+		if herr != nil && err == nil {
+			err = fmt.Errorf("finally:%w", herr)
+		} else if herr != nil {
+			err = fmt.Errorf("%s\nfinally:%s", err, herr)
+		}
+	}
+	return err
+}
+
+// name returns Name or the base name of dst.
+func (j Job) name() string {
+	if j.Name != "" {
+		return j.Name
+	}
+	return filepath.Base(filepath.Clean(j.DstDir))
+}
+
+// placeholders returns values of placeholders for job level hooks.
+// root is the directory where files are collected and dst is the directory to publish them.
+func (j Job) placeholders(root string, dst string) map[string]string {
+	return map[string]string{
+		"${target}":   root,
+		"${dst_root}": root,
+		"${dst}":      dst,
+		"${job_name}": j.name(),
+	}
+}
+
+// listed returns relative paths of files which the job creates.
+func (j Job) listed(srcs []*SrcFile) (map[string]bool, error) {
+	ret := make(map[string]bool)
+	for _, v := range srcs {
+		rel, err := v.RelPath()
+		if err != nil {
+			return nil, err
+		}
+		ret[rel] = true
+		for _, c := range v.ChecksumType {
+			ret[rel+"."+c] = true
+		}
+	}
+	if j.Manifest != nil {
+		ret[filepath.ToSlash(j.Manifest.FileName())] = true
+	}
+	return ret, nil
+}
+
+func (j Job) writeManifest(root string, srcs []*SrcFile) error {
+	alg := j.Manifest.algorithm()
+	entries := []ManifestEntry{}
+	for _, v := range srcs {
+		if v.linkTarget != "" {
+			// sha256sum -c follows symlinks. Only regular files are listed.
+			continue
+		}
+		rel, err := v.RelPath()
+		if err != nil {
+			return err
+		}
+		sum, err := v.Sum(alg)
+		if err != nil {
+			return fmt.Errorf("manifest %s:%w", v.DstPath, err)
+		}
+		entries = append(entries, ManifestEntry{Path: rel, Sum: sum})
+	}
+
+	err := j.Manifest.Write(filepath.Join(root, j.Manifest.FileName()), entries)
+	if err != nil {
+		return fmt.Errorf("manifest:%w", err)
+	}
 	return nil
 }
@@ -17,9 +17,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -81,3 +86,308 @@ func TestJobCheckConfiguration(t *testing.T) {
 		t.Errorf("CheckConfiguration:%s", err)
 	}
 }
+
+func TestJobCheckConfigurationIncremental(t *testing.T) {
+	type testcase struct {
+		onExisting string
+		expect     bool
+	}
+	cases := []testcase{
+		{"", true},
+		{OnExistingMerge, true},
+		{OnExistingFail, false},
+		{OnExistingReplace, false},
+		{OnExistingBackup, false},
+	}
+
+	for _, v := range cases {
+		j := &Job{Srcs: []*SrcFile{{}}, OnExisting: v.onExisting, Incremental: &Incremental{}}
+		err := j.CheckConfiguration()
+		if (err == nil) != v.expect {
+			t.Errorf("%s:given %s expect %v", v.onExisting, err, v.expect)
+		}
+	}
+}
+
+func TestJobCopyAndExecGlob(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "jobglob")
+	if err != nil {
+		t.Fatalf("TempDir(src):%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	dstdir, err := ioutil.TempDir("", "jobglob")
+	if err != nil {
+		t.Fatalf("TempDir(dst):%s", err)
+	}
+	defer os.RemoveAll(dstdir)
+
+	files := []string{"a.txt", "sub/b.txt", "c.md"}
+	for _, v := range files {
+		p := filepath.Join(srcdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	j := &Job{DstDir: filepath.Join(dstdir, "release")}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(srcdir, "**/*.txt"), DstPath: "txt", ChecksumType: ChecksumList{"md5", "sha256"},
+		AfterCmd: Command{Args: []string{"test", "-f", "${target}"}}})
+
+	buf := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(buf, buf)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s %s", err, buf.String())
+	}
+
+	for _, v := range []string{"txt/a.txt", "txt/a.txt.md5", "txt/a.txt.sha256", "txt/sub/b.txt", "txt/sub/b.txt.md5", "txt/sub/b.txt.sha256"} {
+		_, err = os.Stat(filepath.Join(j.DstDir, v))
+		if err != nil {
+			t.Errorf("%s:%s", v, err)
+		}
+	}
+	_, err = os.Stat(filepath.Join(j.DstDir, "txt/c.md"))
+	if err == nil {
+		t.Errorf("c.md should not be copied")
+	}
+}
+
+func TestJobCopyAndExecManifest(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "jobmanifest")
+	if err != nil {
+		t.Fatalf("TempDir(src):%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	dstdir, err := ioutil.TempDir("", "jobmanifest")
+	if err != nil {
+		t.Fatalf("TempDir(dst):%s", err)
+	}
+	defer os.RemoveAll(dstdir)
+
+	for _, v := range []string{"a.txt", "sub/b.txt"} {
+		p := filepath.Join(srcdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	j := &Job{DstDir: filepath.Join(dstdir, "release"), Manifest: &Manifest{}}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(srcdir, "**/*.txt"), ChecksumType: ChecksumList{"md5"}})
+
+	buf := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(buf, buf)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s %s", err, buf.String())
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(j.DstDir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatalf("ReadFile:%s", err)
+	}
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	expect := sum + "  a.txt\n" + sum + "  sub/b.txt\n"
+	if string(b) != expect {
+		t.Errorf("mismatch:\n given= %q\n expect=%q", string(b), expect)
+	}
+
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		return
+	}
+	cmd := exec.Command("sha256sum", "-c", "SHA256SUMS")
+	cmd.Dir = j.DstDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("sha256sum -c:%s %s", err, out)
+	}
+}
+
+func TestJobCopyAndExecExpectedChecksum(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "jobexpected")
+	if err != nil {
+		t.Fatalf("TempDir(src):%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	dstdir, err := ioutil.TempDir("", "jobexpected")
+	if err != nil {
+		t.Fatalf("TempDir(dst):%s", err)
+	}
+	defer os.RemoveAll(dstdir)
+
+	src := filepath.Join(srcdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	j := &Job{DstDir: filepath.Join(dstdir, "release")}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: src, ExpectedChecksum: "md5:00000000000000000000000000000000"})
+
+	buf := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(buf, buf)
+	if err == nil {
+		t.Errorf("mismatch should be error")
+	}
+	_, err = os.Stat(j.DstDir)
+	if !os.IsNotExist(err) {
+		t.Errorf("dst should not be created:%s", err)
+	}
+
+	j.Srcs[0].ExpectedChecksum = "md5:098f6bcd4621d373cade4e832627b4f6"
+	err = j.CopyAndExec(buf, buf)
+	if err != nil {
+		t.Errorf("CopyAndExec:%s", err)
+	}
+}
+
+func TestJobAfterCmdPlaceholders(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "jobaftercmd")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	dst := filepath.Join(tmpdir, "release")
+	j := &Job{Name: "nightly", DstDir: dst, Srcs: []*SrcFile{{Path: src}},
+		AfterCmd: Command{Args: []string{"sh", "-c", "test -f ${dst_root}/a.txt && echo ${job_name} ${dst}"}}}
+
+	buf := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(buf, buf)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s %s", err, buf.String())
+	}
+	expect := "nightly " + dst + "\n"
+	if buf.String() != expect {
+		t.Errorf("given %s expect %s", buf.String(), expect)
+	}
+
+	j.Name = ""
+	if j.name() != "release" {
+		t.Errorf("given %s expect release", j.name())
+	}
+}
+
+func TestJobHooks(t *testing.T) {
+	type testcase struct {
+		name      string
+		src       string
+		onSuccess []string
+		expect    string
+		fail      bool
+		published bool
+	}
+
+	tmpdir, err := ioutil.TempDir("", "jobhooks")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	succ := []string{"sh", "-c", "test -f \"$FC_DST/a.txt\" && test \"$FC_DST_ROOT\" = \"$FC_DST\" && echo success"}
+	cases := []testcase{
+		{"success", src, succ, "before\nsuccess\nfinally ok\n", false, true},
+		{"failure", filepath.Join(tmpdir, "none.txt"), succ, "before\nfailure staging\nfinally error\n", true, false},
+		{"on_success fails", src, []string{"false"}, "before\nfinally error\n", true, true},
+	}
+
+	for i, v := range cases {
+		dst := filepath.Join(tmpdir, fmt.Sprintf("dst%d", i))
+		j := &Job{DstDir: dst, Srcs: []*SrcFile{{Path: v.src}},
+			BeforeCmd: Command{Args: []string{"sh", "-c", "test -d ${target} && echo before"}},
+			OnSuccess: Command{Args: v.onSuccess},
+			OnFailure: Command{Args: []string{"sh", "-c", "test -n \"$FC_ERROR\" && test -d \"$FC_DST_ROOT\" && echo failure staging"}},
+			Finally:   Command{Args: []string{"sh", "-c", "if [ -z \"$FC_ERROR\" ]; then echo finally ok; else echo finally error; fi"}},
+		}
+
+		buf := bytes.NewBuffer([]byte{})
+		err = j.CopyAndExec(buf, buf)
+		if v.fail != (err != nil) {
+			t.Errorf("%s:given %v expect fail %v", v.name, err, v.fail)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s:given %q expect %q", v.name, buf.String(), v.expect)
+		}
+		ok, err := exists(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Errorf("%s:exists %s", v.name, err)
+		} else if ok != v.published {
+			t.Errorf("%s:given %v expect %v", v.name, ok, v.published)
+		}
+	}
+}
+
+func TestJobHooksErrorQuoted(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "jobhookserror")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// the error message has the missing source.
+	src := filepath.Join(tmpdir, "a; touch INJECTED; $(touch INJECTED).txt")
+	j := &Job{DstDir: filepath.Join(tmpdir, "release"), Srcs: []*SrcFile{{Path: src}},
+		OnFailure: Command{Args: []string{"echo ${error}"}, Shell: true, Cwd: tmpdir},
+		Finally:   Command{Args: []string{"sh", "-c", "echo \"$FC_ERROR\""}, Cwd: tmpdir},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(buf, buf)
+	if err == nil {
+		t.Fatalf("error is nil")
+	}
+	expect := strings.TrimSpace(err.Error()) + "\n"
+	if buf.String() != expect+expect {
+		t.Errorf("error message is not passed:%s", buf.String())
+	}
+	if ok, _ := exists(filepath.Join(tmpdir, "INJECTED")); ok {
+		t.Errorf("the error message is executed")
+	}
+}
+
+func TestJobHooksConfigError(t *testing.T) {
+	type testcase struct {
+		name      string
+		onFailure Command
+		expect    string
+	}
+	cases := []testcase{
+		{"valid hooks", Command{Args: []string{"echo", "${error}"}}, "parallelism must not be negative\nfinally\n"},
+		{"invalid hook", Command{Args: []string{"echo", "${error}"}, Retries: -1}, ""},
+	}
+
+	for _, v := range cases {
+		j := &Job{DstDir: "release", Srcs: []*SrcFile{{Path: "a.txt"}}, Parallelism: -1,
+			OnFailure: v.onFailure, Finally: Command{Args: []string{"echo", "finally"}}}
+		buf := bytes.NewBuffer([]byte{})
+		err := j.CopyAndExec(buf, buf)
+		if err == nil {
+			t.Errorf("%s:error is nil", v.name)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s:given %q expect %q", v.name, buf.String(), v.expect)
+		}
+	}
+}
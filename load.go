@@ -0,0 +1,275 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ConfigError is an error at a position of a config file.
+type ConfigError struct {
+	Line   int // 1-based
+	Column int // 1-based
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Column == 0 {
+		// some parsers report only the line.
+		return fmt.Sprintf("%d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// position returns the line and the column of offset in b.
+func position(b []byte, offset int64) (int, int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	head := b[:offset]
+	line := bytes.Count(head, []byte("\n")) + 1
+	col := len(head) - bytes.LastIndexByte(head, '\n')
+	return line, col
+}
+
+// valueError is an error at Offset in the JSON value given to an Unmarshaler.
+// json doesn't report positions of errors of Unmarshalers,
+// so each level adds the offset of its value.
+type valueError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *valueError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *valueError) Unwrap() error {
+	return e.Err
+}
+
+// offsetError returns err as an error of the value at offset.
+func offsetError(offset int64, err error) error {
+	var verr *valueError
+	var typeerr *json.UnmarshalTypeError
+	if errors.As(err, &verr) {
+		return &valueError{Offset: offset + verr.Offset, Err: verr.Err}
+	} else if errors.As(err, &typeerr) {
+		// offsets of json errors are after the wrong value.
+		return &valueError{Offset: offset + typeerr.Offset - 1, Err: err}
+	}
+	return &valueError{Offset: offset, Err: err}
+}
+
+// skipSpaces returns the offset of the next token of b from offset.
+// seps are skipped as well as spaces.
+func skipSpaces(b []byte, offset int64, seps string) int64 {
+	for offset < int64(len(b)) && strings.IndexByte(" \t\r\n"+seps, b[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// decodeObject decodes the JSON object b into the struct v points to.
+// Fields are decoded one by one to return errors with their offsets as *valueError.
+// Unknown fields are errors.
+func decodeObject(b []byte, v interface{}) error {
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		return nil
+	}
+	fields := jsonFields(reflect.ValueOf(v).Elem())
+	dec := json.NewDecoder(bytes.NewReader(b))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		start := skipSpaces(b, 0, "")
+		return &valueError{Offset: start, Err: &json.UnmarshalTypeError{Value: jsonKind(b[start]), Type: reflect.TypeOf(v).Elem()}}
+	}
+	for dec.More() {
+		keyStart := skipSpaces(b, dec.InputOffset(), ",")
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		valueStart := dec.InputOffset()
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return err
+		}
+		field, ok := lookupField(fields, key)
+		if !ok {
+			return &valueError{Offset: keyStart, Err: fmt.Errorf("json: unknown field %q", key)}
+		}
+		if err = decodeValue(raw, field); err != nil {
+			return offsetError(skipSpaces(b, valueStart, ":"), err)
+		}
+	}
+	return nil
+}
+
+// decodeValue decodes raw into v.
+// Elements of slices are decoded one by one to report the offsets of their errors.
+func decodeValue(raw []byte, v reflect.Value) error {
+	if v.Kind() != reflect.Slice || raw[0] != '[' || reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		return json.Unmarshal(raw, v.Addr().Interface())
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	s := reflect.MakeSlice(v.Type(), 0, 0)
+	for dec.More() {
+		start := skipSpaces(raw, dec.InputOffset(), ",")
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return err
+		}
+		e := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeValue(elem, e); err != nil {
+			return offsetError(start, err)
+		}
+		s = reflect.Append(s, e)
+	}
+	v.Set(s)
+	return nil
+}
+
+// jsonFields returns the exported fields of the struct v by their JSON names.
+// Fields of embedded structs are hidden by the outer ones as json does.
+func jsonFields(v reflect.Value) map[string]reflect.Value {
+	ret := map[string]reflect.Value{}
+	embedded := []reflect.Value{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, v.Field(i))
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ret[name] = v.Field(i)
+	}
+	for _, e := range embedded {
+		for name, f := range jsonFields(e) {
+			if _, ok := ret[name]; !ok {
+				ret[name] = f
+			}
+		}
+	}
+	return ret
+}
+
+// lookupField finds the field for key. Keys are case-insensitive as json does.
+func lookupField(fields map[string]reflect.Value, key string) (reflect.Value, bool) {
+	if f, ok := fields[key]; ok {
+		return f, true
+	}
+	for name, f := range fields {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// jsonKind returns the kind of the JSON value starting with c for errors.
+func jsonKind(c byte) string {
+	switch c {
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// DecodeJob decodes a JSON config file strictly.
+// Unknown fields are rejected and "//" comments are allowed.
+// Syntax, type and unknown field errors are *ConfigError.
+func DecodeJob(b []byte) (*Job, error) {
+	b = StripComments(b)
+	return decodeJSON(b, func(offset int64) (int, int) {
+		return position(b, offset)
+	})
+}
+
+// decodeJSON decodes b strictly.
+// pos returns the line and the column of the config file from an offset of b.
+func decodeJSON(b []byte, pos func(int64) (int, int)) (*Job, error) {
+	job := &Job{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	err := dec.Decode(job)
+	if err != nil {
+		var synerr *json.SyntaxError
+		var verr *valueError
+		var typeerr *json.UnmarshalTypeError
+		// offsets of json errors are after the wrong byte or value.
+		if errors.As(err, &synerr) {
+			line, col := pos(synerr.Offset - 1)
+			return nil, &ConfigError{Line: line, Column: col, Err: err}
+		} else if errors.As(err, &verr) {
+			// offsets of valueError are relative to the config object.
+			line, col := pos(skipSpaces(b, 0, "") + verr.Offset)
+			return nil, &ConfigError{Line: line, Column: col, Err: verr.Err}
+		} else if errors.As(err, &typeerr) {
+			line, col := pos(typeerr.Offset - 1)
+			return nil, &ConfigError{Line: line, Column: col, Err: err}
+		} else if err == io.EOF {
+			return nil, fmt.Errorf("config is empty")
+		}
+		return nil, err
+	}
+
+	offset := dec.InputOffset()
+	rest := b[offset:]
+	offset += int64(len(rest) - len(bytes.TrimLeft(rest, " \t\r\n")))
+	_, err = dec.Token()
+	if err != io.EOF {
+		line, col := pos(offset)
+		return nil, &ConfigError{Line: line, Column: col, Err: fmt.Errorf("unexpected data after the config")}
+	}
+	return job, nil
+}
@@ -0,0 +1,75 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeJob(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   string
+		success bool
+		line    int
+		column  int
+	}
+
+	cases := []testcase{
+		{"normal", "{\"srcs\":[{\"path\":\"a.txt\"}],\n \"dst\":\"dst\"}", true, 0, 0},
+		{"comment", "// comment\n{\"srcs\":[{\"path\":\"a.txt\"}], // comment\n \"dst\":\"dst\"}", true, 0, 0},
+		{"empty", "", false, 0, 0},
+		{"syntax", "{\"srcs\":[\n{\"path\":\"a.txt\",}]}", false, 2, 17},
+		{"type", "{\"srcs\":[],\n \"dst\":1}", false, 2, 8},
+		{"unknown field", "{\"srcs\":[],\n  \"dest\":\"dst\"}", false, 2, 3},
+		{"unknown src field", "{\"srcs\":[\n {\"path\":\"a.txt\", \"dstpath\":\"b\"}]}", false, 2, 19},
+		{"unknown command field", "{\"srcs\":[{\"path\":\"a\",\n \"after_cmd\":{\"cmd\":\"ls\", \"shel\":true}}]}", false, 2, 27},
+		{"checksum type", "{\"srcs\":[{\"path\":\"a\",\n \"checksum\":5}]}", false, 2, 13},
+		{"before_cmd type", "{\"srcs\":[{\"path\":\"a\",\n \"before_cmd\":5}]}", false, 2, 15},
+		{"timeout type", "{\"srcs\":[{\"path\":\"a\",\n \"after_cmd\":{\"cmd\":\"ls\",\n  \"timeout\":true}}]}", false, 3, 13},
+		{"job timeout type", "{\"srcs\":[],\n \"finally\":{\"cmd\":\"ls\", \"backoff\":\"1x\"}}", false, 2, 35},
+		{"repeated unknown field", "{\"name\":\"a\", \"srcs\":[\n {\"path\":\"a\", \"name\":\"b\"}]}", false, 2, 15},
+		{"src type", "{\"srcs\":[{\"path\":\"a\"},\n 5]}", false, 2, 2},
+		{"trailing data", "{\"srcs\":[]}\n{}", false, 2, 1},
+	}
+
+	for _, v := range cases {
+		_, err := DecodeJob([]byte(v.input))
+		if v.success {
+			if err != nil {
+				t.Errorf("%s:%s", v.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s:it should be error", v.name)
+			continue
+		}
+		if v.line == 0 {
+			continue
+		}
+		var cerr *ConfigError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%s:not ConfigError %s", v.name, err)
+			continue
+		}
+		if cerr.Line != v.line || cerr.Column != v.column {
+			t.Errorf("%s:given %d:%d expect %d:%d", v.name, cerr.Line, cerr.Column, v.line, v.column)
+		}
+	}
+}
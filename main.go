@@ -17,12 +17,13 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 const version string = "0.0.3"
@@ -32,6 +33,7 @@ const (
 	ExitOK int = iota
 	ExitArgError
 	ExitCmdError
+	ExitVerifyError
 )
 
 // CLI has In/Out/Err streams.
@@ -42,9 +44,56 @@ type CLI struct {
 	quiet     bool // for testing to suppress output
 }
 
+const usage = `Usage: file-collector <command> [options]
+
+Commands:
+  run       collect files. "file-collector -c config.json" is the same as "run".
+  plan      show what run would do
+  validate  check a config file
+  verify    check a collected directory
+  init      create an example config file
+  version   show version
+
+Run "file-collector <command> -h" to show options of each command.
+`
+
 // Run executes real main function.
 func (cli *CLI) Run(args []string) (ret int) {
-	cnf, err := Configure(args[1:], cli.quiet)
+	if len(args) < 2 {
+		fmt.Fprintf(cli.ErrStream, "%s", usage)
+		return ExitArgError
+	}
+
+	switch args[1] {
+	case "run":
+		return cli.runJob(args[2:])
+	case "plan":
+		return cli.runPlan(args[2:])
+	case "validate":
+		return cli.runValidate(args[2:])
+	case "verify":
+		return cli.runVerify(args[2:])
+	case "init":
+		return cli.runInit(args[2:])
+	case "version":
+		return cli.runVersion(args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintf(cli.OutStream, "%s", usage)
+		return ExitOK
+	}
+
+	if !strings.HasPrefix(args[1], "-") {
+		fmt.Fprintf(cli.ErrStream, "unknown command:%s\n%s", args[1], usage)
+		return ExitArgError
+	}
+	// file-collector -c config.json
+	return cli.runJob(args[1:])
+}
+
+// runJob collects files.
+// Pass os.Args[2:]
+func (cli *CLI) runJob(args []string) int {
+	cnf, err := Configure(args, cli.quiet)
 	if err != nil {
 		if err == flag.ErrHelp {
 			return ExitOK
@@ -54,36 +103,221 @@ func (cli *CLI) Run(args []string) (ret int) {
 	}
 
 	if cnf.showVersion {
-		fmt.Fprintf(cli.OutStream, "Ver: %s\n", version)
-		return ExitOK
+		return cli.runVersion(nil)
 	}
 	if cnf.ConfigFilePath == "" {
-		fmt.Fprintf(cli.ErrStream, "config file is missing")
+		fmt.Fprintf(cli.ErrStream, "config file is missing\n")
 		return ExitArgError
 	}
 
-	b, err := ioutil.ReadFile(cnf.ConfigFilePath)
+	job, ok := cli.loadJob(cnf.ConfigFilePath, cnf.Format)
+	if !ok {
+		return ExitCmdError
+	}
+	if cnf.Jobs != 0 {
+		job.Parallelism = cnf.Jobs
+	}
+
+	err = job.CopyAndExec(cli.OutStream, cli.ErrStream)
 	if err != nil {
-		fmt.Fprintf(cli.ErrStream, "ReadFile:%s", err)
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
 		return ExitCmdError
 	}
-	job := &Job{}
-	err = json.Unmarshal(b, &job)
+
+	return ExitOK
+}
+
+// runVersion prints the version.
+// Pass os.Args[2:]
+func (cli *CLI) runVersion(args []string) int {
+	err := ConfigureVersion(args, cli.quiet)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
+		return ExitArgError
+	}
+	fmt.Fprintf(cli.OutStream, "Ver: %s\n", version)
+	return ExitOK
+}
+
+// runValidate checks a config file without copying files.
+// Pass os.Args[2:]
+func (cli *CLI) runValidate(args []string) int {
+	cnf, err := ConfigureValidate(args, cli.quiet)
 	if err != nil {
-		fmt.Fprintf(cli.ErrStream, "Unmarshal:%s\n", err)
-		synerr, ok := err.(*json.SyntaxError)
-		if ok {
-			fmt.Fprintf(cli.ErrStream, "  %s\n", string(b[synerr.Offset:]))
+		if err == flag.ErrHelp {
+			return ExitOK
 		}
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
+		return ExitArgError
+	}
+
+	job, ok := cli.loadJob(cnf.ConfigFilePath, cnf.Format)
+	if !ok {
+		return ExitCmdError
+	}
+	errs := job.Validate()
+	for _, v := range errs {
+		fmt.Fprintf(cli.ErrStream, "%s: %s\n", cnf.ConfigFilePath, v)
+	}
+	if len(errs) > 0 {
 		return ExitCmdError
 	}
+	fmt.Fprintf(cli.OutStream, "%s: OK\n", cnf.ConfigFilePath)
+	return ExitOK
+}
 
-	err = job.CopyAndExec(cli.OutStream, cli.ErrStream)
+// runInit creates an example config file.
+// Pass os.Args[2:]
+func (cli *CLI) runInit(args []string) int {
+	cnf, err := ConfigureInit(args, cli.quiet)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
+		return ExitArgError
+	}
+
+	if cnf.OutputPath == "-" {
+		fmt.Fprintf(cli.OutStream, "%s", ExampleConfig)
+		return ExitOK
+	}
+	err = WriteExampleConfig(cnf.OutputPath, cnf.Force)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
+		return ExitCmdError
+	}
+	fmt.Fprintf(cli.OutStream, "%s is created\n", cnf.OutputPath)
+	return ExitOK
+}
+
+// loadJob reads a config file. Errors are printed to ErrStream.
+// format is guessed from the extension of path if it is blank.
+func (cli *CLI) loadJob(path string, format string) (*Job, bool) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "ReadFile:%s", err)
+		return nil, false
+	}
+	if format == "" {
+		format = FormatFromFileName(path)
+	}
+	job, err := LoadJob(b, format)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "%s:%s\n", path, err)
+		return nil, false
+	}
+	return job, true
+}
+
+// runVerify re-checks a collected directory against its checksums.
+// Pass os.Args[2:]
+func (cli *CLI) runVerify(args []string) int {
+	cnf, err := ConfigureVerify(args, cli.quiet)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
+		return ExitArgError
+	}
+
+	dir := cnf.DstDir
+	var manifest *Manifest
+	if cnf.ConfigFilePath != "" {
+		job, ok := cli.loadJob(cnf.ConfigFilePath, cnf.Format)
+		if !ok {
+			return ExitCmdError
+		}
+		// dst may have variables like "release/${VERSION}".
+		job, err = job.Interpolate()
+		if err != nil {
+			fmt.Fprintf(cli.ErrStream, "%s\n", err)
+			return ExitCmdError
+		}
+		if dir == "" {
+			dir = job.DstDir
+		}
+		manifest = job.Manifest
+	}
+
+	if cnf.ManifestName != "" {
+		manifest = &Manifest{Name: cnf.ManifestName, Algorithm: cnf.Algorithm}
+		if manifest.Algorithm == "" {
+			alg, ok := AlgorithmFromFileName(cnf.ManifestName)
+			if !ok {
+				fmt.Fprintf(cli.ErrStream, "algorithm of %s is unknown. Use -a\n", cnf.ManifestName)
+				return ExitArgError
+			}
+			manifest.Algorithm = alg
+		}
+	} else if manifest == nil {
+		// find a manifest like SHA256SUMS
+		for _, v := range HashNames() {
+			m := &Manifest{Algorithm: v}
+			if _, err := os.Stat(filepath.Join(dir, m.FileName())); err == nil {
+				manifest = m
+				break
+			}
+		}
+	} else if cnf.Algorithm != "" {
+		manifest = &Manifest{Name: manifest.Name, Algorithm: cnf.Algorithm}
+	}
+
+	if manifest != nil {
+		err = manifest.CheckConfiguration()
+		if err != nil {
+			fmt.Fprintf(cli.ErrStream, "%s\n", err)
+			return ExitArgError
+		}
+	}
+
+	report, err := Verify(dir, manifest)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "verify:%s\n", err)
+		return ExitCmdError
+	}
+	report.Print(cli.OutStream)
+	if !report.OK() {
+		return ExitVerifyError
+	}
+	return ExitOK
+}
+
+// runPlan prints what the job would do without copying files or executing commands.
+// Pass os.Args[2:]
+func (cli *CLI) runPlan(args []string) int {
+	cnf, err := ConfigurePlan(args, cli.quiet)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		fmt.Fprintf(cli.ErrStream, "%s\n", err)
+		return ExitArgError
+	}
+
+	job, ok := cli.loadJob(cnf.ConfigFilePath, cnf.Format)
+	if !ok {
+		return ExitCmdError
+	}
+	plan, err := job.Plan()
 	if err != nil {
 		fmt.Fprintf(cli.ErrStream, "%s\n", err)
 		return ExitCmdError
 	}
 
+	if cnf.JSON {
+		err = plan.PrintJSON(cli.OutStream)
+		if err != nil {
+			fmt.Fprintf(cli.ErrStream, "%s\n", err)
+			return ExitCmdError
+		}
+		return ExitOK
+	}
+	plan.Print(cli.OutStream)
 	return ExitOK
 }
 
@@ -18,6 +18,9 @@ package main
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -33,6 +36,14 @@ func TestCliRun(t *testing.T) {
 		{"no args", []string{}, ExitArgError},
 		{"show Version", []string{"-V"}, ExitOK},
 		{"help", []string{"-h"}, ExitOK},
+		{"help command", []string{"help"}, ExitOK},
+		{"version", []string{"version"}, ExitOK},
+		{"run help", []string{"run", "-h"}, ExitOK},
+		{"run no config", []string{"run"}, ExitArgError},
+		{"plan help", []string{"plan", "-h"}, ExitOK},
+		{"validate help", []string{"validate", "-h"}, ExitOK},
+		{"init help", []string{"init", "-h"}, ExitOK},
+		{"unknown command", []string{"unknown"}, ExitArgError},
 	}
 
 	nullbuf := bytes.NewBuffer([]byte{})
@@ -63,3 +74,179 @@ func TestShowVersion(t *testing.T) {
 		t.Errorf("not version string: %s", string(buf.Bytes()))
 	}
 }
+
+func TestCliVerify(t *testing.T) {
+	dstdir := createVerifyDir(t)
+	defer os.RemoveAll(dstdir)
+	root := filepath.Join(dstdir, "release")
+
+	buf := bytes.NewBuffer([]byte{})
+	cli := &CLI{OutStream: buf, ErrStream: buf, quiet: true}
+
+	ret := cli.Run([]string{"program-name", "verify", "-d", root})
+	if ret != ExitOK {
+		t.Errorf("ret is not ExitOK, ret=%d %s", ret, buf.String())
+	}
+
+	err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+	buf.Reset()
+	ret = cli.Run([]string{"program-name", "verify", "-d", root, "-m", "SHA256SUMS"})
+	if ret != ExitVerifyError {
+		t.Errorf("ret is not ExitVerifyError, ret=%d %s", ret, buf.String())
+	}
+	if !strings.Contains(buf.String(), "corrupted: a.txt") {
+		t.Errorf("corrupted file is not reported: %s", buf.String())
+	}
+
+	buf.Reset()
+	ret = cli.Run([]string{"program-name", "verify", "-d", root, "-m", "checksums.txt"})
+	if ret != ExitArgError {
+		t.Errorf("ret is not ExitArgError, ret=%d %s", ret, buf.String())
+	}
+}
+
+func TestCliVerifyVars(t *testing.T) {
+	dstdir := createVerifyDir(t)
+	defer os.RemoveAll(dstdir)
+
+	config := filepath.Join(dstdir, "config.json")
+	b := []byte(`{"srcs":[{"path":"a.txt"}], "dst":"` + filepath.Join(dstdir, "${NAME}") + `", "manifest":{}, "vars":{"NAME":"release"}}`)
+	err := ioutil.WriteFile(config, b, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	cli := &CLI{OutStream: buf, ErrStream: buf, quiet: true}
+	ret := cli.Run([]string{"program-name", "verify", "-c", config})
+	if ret != ExitOK {
+		t.Errorf("ret is not ExitOK, ret=%d %s", ret, buf.String())
+	}
+}
+
+func TestCliInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cliinit")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.json")
+
+	buf := bytes.NewBuffer([]byte{})
+	cli := &CLI{OutStream: buf, ErrStream: buf, quiet: true}
+
+	ret := cli.Run([]string{"program-name", "init", "-o", config})
+	if ret != ExitOK {
+		t.Fatalf("ret is not ExitOK, ret=%d %s", ret, buf.String())
+	}
+	ret = cli.Run([]string{"program-name", "init", "-o", config})
+	if ret != ExitCmdError {
+		t.Errorf("ret is not ExitCmdError, ret=%d %s", ret, buf.String())
+	}
+
+	// the commented config should be loaded.
+	b, err := ioutil.ReadFile(config)
+	if err != nil {
+		t.Fatalf("ReadFile:%s", err)
+	}
+	_, err = DecodeJob(b)
+	if err != nil {
+		t.Errorf("DecodeJob:%s", err)
+	}
+}
+
+func TestCliValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clivalidate")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		input  string
+		expect int
+		output string
+	}
+	cases := []testcase{
+		{"ok", "{\"srcs\":[{\"path\":\"" + src + "\"}],\n\"dst\":\"release\"}", ExitOK, "OK"},
+		{"typo", "{\"srcs\":[{\"path\":\"" + src + "\"}],\n\"dest\":\"release\"}", ExitCmdError, "config.json:2:1: json: unknown field \"dest\""},
+		{"semantic", "{\"srcs\":[{\"path\":\"" + src + "\", \"checksum\":\"md4\"}]}", ExitCmdError, "dst is missing"},
+	}
+
+	config := filepath.Join(dir, "config.json")
+	buf := bytes.NewBuffer([]byte{})
+	cli := &CLI{OutStream: buf, ErrStream: buf, quiet: true}
+	for _, v := range cases {
+		err = ioutil.WriteFile(config, []byte(v.input), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile:%s", err)
+		}
+		buf.Reset()
+		ret := cli.Run([]string{"program-name", "validate", "-c", config})
+		if ret != v.expect {
+			t.Errorf("%s:given %d expect %d %s", v.name, ret, v.expect, buf.String())
+		}
+		if !strings.Contains(buf.String(), v.output) {
+			t.Errorf("%s:given %s expect %s", v.name, buf.String(), v.output)
+		}
+	}
+}
+
+func TestCliFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cliformat")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		file   string
+		args   []string
+		input  string
+		expect int
+		output string
+	}
+	cases := []testcase{
+		{"yaml", "config.yaml", nil, "srcs:\n  - path: " + src + "\ndst: release\n", ExitOK, "OK"},
+		{"yaml typo", "config.yml", nil, "srcs:\n  - path: " + src + "\n    dest: b\ndst: release\n", ExitCmdError, "config.yml:3:5: json: unknown field \"dest\""},
+		{"toml", "config.toml", nil, "dst = \"release\"\n[[srcs]]\npath = \"" + src + "\"\n", ExitOK, "OK"},
+		{"format flag", "config.conf", []string{"-format", "toml"}, "dst = \"release\"\n[[srcs]]\npath = \"" + src + "\"\n", ExitOK, "OK"},
+		{"unknown format", "config.conf", []string{"-format", "xml"}, "", ExitCmdError, "unknown format"},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	cli := &CLI{OutStream: buf, ErrStream: buf, quiet: true}
+	for _, v := range cases {
+		config := filepath.Join(dir, v.file)
+		err = ioutil.WriteFile(config, []byte(v.input), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile:%s", err)
+		}
+		buf.Reset()
+		args := append([]string{"program-name", "validate", "-c", config}, v.args...)
+		ret := cli.Run(args)
+		if ret != v.expect {
+			t.Errorf("%s:given %d expect %d %s", v.name, ret, v.expect, buf.String())
+		}
+		if !strings.Contains(buf.String(), v.output) {
+			t.Errorf("%s:given %s expect %s", v.name, buf.String(), v.output)
+		}
+	}
+}
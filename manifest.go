@@ -0,0 +1,155 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sort orders of manifest entries
+const (
+	ManifestSortPath = "path" // lexical order of relative path
+	ManifestSortNone = "none" // order of srcs
+)
+
+// Manifest is a configuration of a checksum manifest of a job.
+// The manifest is written at the destination root in sha256sum/md5sum format.
+type Manifest struct {
+	Name      string `json:"name,omitempty"`      // default: e.g. SHA256SUMS
+	Algorithm string `json:"algorithm,omitempty"` // default: sha256
+	Sort      string `json:"sort,omitempty"`      // "path"(default) or "none"
+}
+
+// UnmarshalJSON decodes the object strictly and reports positions of errors.
+func (m *Manifest) UnmarshalJSON(b []byte) error {
+	return decodeObject(b, m)
+}
+
+// ManifestEntry is a line of a manifest.
+type ManifestEntry struct {
+	Path string // slash separated relative path
+	Sum  []byte
+}
+
+func (m Manifest) algorithm() string {
+	if m.Algorithm == "" {
+		return "sha256"
+	}
+	return m.Algorithm
+}
+
+// FileName returns the manifest file name.
+func (m Manifest) FileName() string {
+	if m.Name == "" {
+		return strings.ToUpper(m.algorithm()) + "SUMS"
+	}
+	return m.Name
+}
+
+// CheckConfiguration checks algorithm, sort order and file name.
+func (m Manifest) CheckConfiguration() error {
+	_, err := NewHash(m.algorithm())
+	if err != nil {
+		return fmt.Errorf("manifest:%w", err)
+	}
+	switch m.Sort {
+	case "", ManifestSortPath, ManifestSortNone:
+	default:
+		return fmt.Errorf("manifest: unknown sort order %s", m.Sort)
+	}
+	if filepath.IsAbs(m.Name) || !IsSubDir(".", m.Name) {
+		return fmt.Errorf("manifest: %s should be under dst", m.Name)
+	}
+	return nil
+}
+
+// Write writes entries in sha256sum/md5sum format to path.
+func (m Manifest) Write(path string, entries []ManifestEntry) error {
+	if m.Sort == "" || m.Sort == ManifestSortPath {
+		sorted := append([]ManifestEntry{}, entries...)
+		sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].Path < sorted[b].Path })
+		entries = sorted
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = WriteManifest(f, entries)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteManifest writes entries as "<hex>  <path>" lines.
+func WriteManifest(w io.Writer, entries []ManifestEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range entries {
+		_, err := fmt.Fprintf(bw, "%x  %s\n", v.Sum, v.Path)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadManifest reads sha256sum/md5sum format lines.
+// Both text mode "<hex>  <path>" and binary mode "<hex> *<path>" are accepted.
+func ReadManifest(r io.Reader) ([]ManifestEntry, error) {
+	ret := []ManifestEntry{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := scanner.Text()
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		idx := strings.Index(s, " ")
+		if idx < 0 || len(s) < idx+3 || (s[idx+1] != ' ' && s[idx+1] != '*') {
+			return nil, fmt.Errorf("line %d: invalid format", line)
+		}
+		sum, err := hex.DecodeString(s[:idx])
+		if err != nil {
+			return nil, fmt.Errorf("line %d:%w", line, err)
+		}
+		ret = append(ret, ManifestEntry{Path: s[idx+2:], Sum: sum})
+	}
+	return ret, scanner.Err()
+}
+
+// AlgorithmFromFileName guesses an algorithm from a manifest name like SHA256SUMS.
+func AlgorithmFromFileName(name string) (string, bool) {
+	base := filepath.Base(name)
+	if !strings.HasSuffix(base, "SUMS") {
+		return "", false
+	}
+	alg := strings.ToLower(strings.TrimSuffix(base, "SUMS"))
+	if _, err := NewHash(alg); err != nil {
+		return "", false
+	}
+	return alg, true
+}
@@ -0,0 +1,177 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestFileName(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  Manifest
+		expect string
+	}
+
+	cases := []testcase{
+		{"default", Manifest{}, "SHA256SUMS"},
+		{"algorithm", Manifest{Algorithm: "md5"}, "MD5SUMS"},
+		{"name", Manifest{Name: "checksums.txt", Algorithm: "md5"}, "checksums.txt"},
+	}
+
+	for _, v := range cases {
+		ret := v.input.FileName()
+		if ret != v.expect {
+			t.Errorf("%s:given %s expect %s", v.name, ret, v.expect)
+		}
+	}
+}
+
+func TestManifestCheckConfiguration(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   Manifest
+		success bool
+	}
+
+	cases := []testcase{
+		{"default", Manifest{}, true},
+		{"full", Manifest{Name: "SUMS", Algorithm: "sha1", Sort: ManifestSortNone}, true},
+		{"unknown algorithm", Manifest{Algorithm: "unknown"}, false},
+		{"unknown sort", Manifest{Sort: "size"}, false},
+		{"outside", Manifest{Name: "../SUMS"}, false},
+		{"absolute", Manifest{Name: "/tmp/SUMS"}, false},
+	}
+
+	for _, v := range cases {
+		err := v.input.CheckConfiguration()
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	entries := []ManifestEntry{
+		{Path: "b.txt", Sum: []byte{0x01, 0x02}},
+		{Path: "sub/a.txt", Sum: []byte{0xab}},
+	}
+
+	err := WriteManifest(buf, entries)
+	if err != nil {
+		t.Fatalf("WriteManifest:%s", err)
+	}
+	expect := "0102  b.txt\nab  sub/a.txt\n"
+	if buf.String() != expect {
+		t.Errorf("mismatch:\n given= %q\n expect=%q", buf.String(), expect)
+	}
+}
+
+func TestManifestWriteSort(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	entries := []ManifestEntry{
+		{Path: "b.txt", Sum: []byte{0x01}},
+		{Path: "a.txt", Sum: []byte{0x02}},
+	}
+
+	type testcase struct {
+		sort   string
+		expect string
+	}
+	cases := []testcase{
+		{"", "02  a.txt\n01  b.txt\n"},
+		{ManifestSortPath, "02  a.txt\n01  b.txt\n"},
+		{ManifestSortNone, "01  b.txt\n02  a.txt\n"},
+	}
+
+	for _, v := range cases {
+		p := filepath.Join(tmpdir, "SUMS")
+		err = Manifest{Sort: v.sort}.Write(p, entries)
+		if err != nil {
+			t.Errorf("%s:%s", v.sort, err)
+			continue
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Errorf("%s:%s", v.sort, err)
+			continue
+		}
+		if string(b) != v.expect {
+			t.Errorf("%s:mismatch:\n given= %q\n expect=%q", v.sort, string(b), v.expect)
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	input := "0102  b.txt\nab *sub/a b.txt\n\n"
+	entries, err := ReadManifest(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadManifest:%s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("given %d entries expect 2", len(entries))
+	}
+	if entries[0].Path != "b.txt" || fmt.Sprintf("%x", entries[0].Sum) != "0102" {
+		t.Errorf("entry 0:given %v", entries[0])
+	}
+	if entries[1].Path != "sub/a b.txt" || fmt.Sprintf("%x", entries[1].Sum) != "ab" {
+		t.Errorf("entry 1:given %v", entries[1])
+	}
+
+	for _, v := range []string{"0102", "0102 b.txt", "xyz  b.txt"} {
+		_, err = ReadManifest(strings.NewReader(v))
+		if err == nil {
+			t.Errorf("%q should be error", v)
+		}
+	}
+}
+
+func TestAlgorithmFromFileName(t *testing.T) {
+	type testcase struct {
+		name   string
+		ok     bool
+		expect string
+	}
+
+	cases := []testcase{
+		{"SHA256SUMS", true, "sha256"},
+		{"dir/MD5SUMS", true, "md5"},
+		{"UNKNOWNSUMS", false, ""},
+		{"checksums.txt", false, ""},
+	}
+
+	for _, v := range cases {
+		ret, ok := AlgorithmFromFileName(v.name)
+		if ok != v.ok || ret != v.expect {
+			t.Errorf("%s:given %s,%t expect %s,%t", v.name, ret, ok, v.expect, v.ok)
+		}
+	}
+}
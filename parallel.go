@@ -0,0 +1,172 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// errCanceled is an error of srcs which are not started because of another error.
+var errCanceled = errors.New("canceled")
+
+// srcResult is a result of copying a src in a worker.
+type srcResult struct {
+	skipped bool
+	out     *bytes.Buffer // buffered output. nil if discarded.
+	errOut  *bytes.Buffer
+	err     error
+}
+
+// copySrcs copies srcs into root with j.Parallelism workers.
+// Output of each src is buffered and written in the order of srcs.
+// The first error in the order of srcs is returned and srcs which are not started yet are canceled.
+func (j Job) copySrcs(srcs []*SrcFile, root string, dst string, cmdout io.Writer, cmderr io.Writer) (*SyncStats, error) {
+	stats := &SyncStats{}
+	if j.Parallelism <= 1 || len(srcs) <= 1 {
+		for _, v := range srcs {
+			skipped, err := j.copySrc(v, root, dst, cmdout, cmderr)
+			if err != nil {
+				return nil, err
+			}
+			stats.add(skipped)
+		}
+		return stats, nil
+	}
+
+	if j.serialHooks() {
+		lock := &sync.Mutex{}
+		for _, v := range srcs {
+			v.hookLock = lock
+		}
+	}
+
+	results := make([]chan srcResult, len(srcs))
+	for i := range results {
+		results[i] = make(chan srcResult, 1)
+	}
+	queue := make(chan int)
+	stop := make(chan struct{})
+	once := &sync.Once{}
+	cancel := func() {
+		once.Do(func() { close(stop) })
+	}
+
+	wg := &sync.WaitGroup{}
+	// files must not be written after returning since root may be removed.
+	defer wg.Wait()
+	defer cancel()
+
+	for n := 0; n < j.Parallelism && n < len(srcs); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				r := j.copySrcBuffered(srcs[i], root, dst, cmdout != nil, cmderr != nil)
+				if r.err != nil {
+					// stop dispatching at once. The error is reported in the order of srcs.
+					cancel()
+				}
+				results[i] <- r
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for i := range srcs {
+			// srcs are dispatched in order. Canceled srcs are after the failed one.
+			select {
+			case <-stop:
+				cancelFrom(results, i)
+				return
+			default:
+			}
+			select {
+			case queue <- i:
+			case <-stop:
+				cancelFrom(results, i)
+				return
+			}
+		}
+	}()
+
+	for _, c := range results {
+		r := <-c
+		if r.out != nil {
+			cmdout.Write(r.out.Bytes())
+		}
+		if r.errOut != nil {
+			cmderr.Write(r.errOut.Bytes())
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		stats.add(r.skipped)
+	}
+	return stats, nil
+}
+
+// cancelFrom reports srcs from i which are not started as canceled.
+func cancelFrom(results []chan srcResult, i int) {
+	for ; i < len(results); i++ {
+		results[i] <- srcResult{err: errCanceled}
+	}
+}
+
+// copySrcBuffered calls copySrc with buffers for output.
+func (j Job) copySrcBuffered(v *SrcFile, root string, dst string, out bool, errOut bool) srcResult {
+	ret := srcResult{}
+	var stdout, stderr io.Writer
+	if out {
+		ret.out = &bytes.Buffer{}
+		stdout = ret.out
+	}
+	if errOut {
+		ret.errOut = &bytes.Buffer{}
+		stderr = ret.errOut
+	}
+	ret.skipped, ret.err = j.copySrc(v, root, dst, stdout, stderr)
+	return ret
+}
+
+// copySrc copies v into root unless it is unchanged in dst.
+// It returns true if v is skipped.
+func (j Job) copySrc(v *SrcFile, root string, dst string, cmdout io.Writer, cmderr io.Writer) (bool, error) {
+	if j.Incremental != nil {
+		ok, err := j.Incremental.Unchanged(v, dst)
+		if err != nil {
+			return false, fmt.Errorf("%s error:%s", v.Path, err)
+		}
+		if ok {
+			return true, v.Normalize(dst)
+		}
+	}
+
+	err := v.copyAndExec(root, cmdout, cmderr)
+	if err != nil {
+		return false, fmt.Errorf("%s error:%s", v.Path, err)
+	}
+	return false, nil
+}
+
+// serialHooks reports whether hooks of srcs are executed one at a time.
+func (j Job) serialHooks() bool {
+	return j.SerialHooks == nil || *j.SerialHooks
+}
@@ -0,0 +1,177 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createSrcs creates n text files and returns srcs of them.
+func createSrcs(t *testing.T, dir string, n int) []*SrcFile {
+	t.Helper()
+	srcs := []*SrcFile{}
+	for i := 0; i < n; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("%02d.txt", i))
+		err := createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+		srcs = append(srcs, &SrcFile{Path: p, ChecksumType: ChecksumList{"sha256"}})
+	}
+	return srcs
+}
+
+func TestParallelOutputOrder(t *testing.T) {
+	type testcase struct {
+		name        string
+		parallelism int
+	}
+
+	tmpdir, err := ioutil.TempDir("", "parallel")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	srcdir := filepath.Join(tmpdir, "src")
+	err = os.Mkdir(srcdir, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir:%s", err)
+	}
+	srcs := createSrcs(t, srcdir, 20)
+
+	expect := ""
+	for _, v := range srcs {
+		expect += "[" + v.Path + "] " + filepath.Base(v.Path) + "\n"
+		v.AfterCmd = Command{Args: []string{"sh", "-c", "echo ${basename}"}}
+	}
+
+	cases := []testcase{
+		{"serial", 1},
+		{"parallel", 4},
+		{"more workers than srcs", 32},
+	}
+
+	for _, v := range cases {
+		dst := filepath.Join(tmpdir, v.name)
+		j := &Job{DstDir: dst, Srcs: srcs, Parallelism: v.parallelism}
+		buf := bytes.NewBuffer([]byte{})
+		err = j.CopyAndExec(buf, buf)
+		if err != nil {
+			t.Errorf("%s:CopyAndExec %s", v.name, err)
+			continue
+		}
+		if buf.String() != expect {
+			t.Errorf("%s:given %s expect %s", v.name, buf.String(), expect)
+		}
+		for _, s := range srcs {
+			b, err := ioutil.ReadFile(filepath.Join(dst, filepath.Base(s.Path)+".sha256"))
+			if err != nil || len(b) != 64 {
+				t.Errorf("%s:checksum of %s %s", v.name, s.Path, err)
+			}
+		}
+	}
+}
+
+func TestParallelFirstError(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "parallelerr")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	for _, v := range []string{"src", "started"} {
+		err = os.Mkdir(filepath.Join(tmpdir, v), 0755)
+		if err != nil {
+			t.Fatalf("Mkdir:%s", err)
+		}
+	}
+	srcs := createSrcs(t, filepath.Join(tmpdir, "src"), 20)
+	for _, v := range srcs {
+		v.BeforeCmd = Command{Args: []string{"touch", filepath.Join(tmpdir, "started", "${basename}")}}
+		v.AfterCmd = Command{Args: []string{"sleep", "0.1"}}
+	}
+	// the later error finishes first.
+	srcs[0].AfterCmd = Command{Args: []string{"sh", "-c", "sleep 0.5; exit 1"}}
+	srcs[5].AfterCmd = Command{Args: []string{"false"}}
+
+	dst := filepath.Join(tmpdir, "release")
+	f := false
+	j := &Job{DstDir: dst, Srcs: srcs, Parallelism: 4, SerialHooks: &f}
+	err = j.CopyAndExec(nil, nil)
+	if err == nil {
+		t.Fatalf("error is nil")
+	}
+	if !strings.HasPrefix(err.Error(), srcs[0].Path+" error:") {
+		t.Errorf("given %s expect error of %s", err, srcs[0].Path)
+	}
+	if ok, _ := exists(dst); ok {
+		t.Errorf("%s should not be published", dst)
+	}
+
+	// srcs[5] fails while srcs[0] is running. srcs after running ones should not be started.
+	for _, v := range srcs[5+j.Parallelism:] {
+		if ok, _ := exists(filepath.Join(tmpdir, "started", filepath.Base(v.Path))); ok {
+			t.Errorf("%s should not be started", v.Path)
+		}
+	}
+}
+
+func TestParallelSerialHooks(t *testing.T) {
+	type testcase struct {
+		name   string
+		serial *bool
+		fail   bool
+	}
+
+	tmpdir, err := ioutil.TempDir("", "parallelhooks")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	srcdir := filepath.Join(tmpdir, "src")
+	err = os.Mkdir(srcdir, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir:%s", err)
+	}
+	srcs := createSrcs(t, srcdir, 4)
+
+	// mkdir fails if another hook is running.
+	lock := filepath.Join(tmpdir, "lock")
+	for _, v := range srcs {
+		v.BeforeCmd = Command{Args: []string{"sh", "-c", "mkdir " + lock + " && sleep 0.1 && rmdir " + lock}}
+	}
+
+	f := false
+	cases := []testcase{
+		{"default", nil, false},
+		{"concurrent", &f, true},
+	}
+
+	for _, v := range cases {
+		os.RemoveAll(lock)
+		j := &Job{DstDir: filepath.Join(tmpdir, v.name), Srcs: srcs, Parallelism: 4, SerialHooks: v.serial}
+		err = j.CopyAndExec(nil, nil)
+		if v.fail != (err != nil) {
+			t.Errorf("%s:given %v expect fail %v", v.name, err, v.fail)
+		}
+	}
+}
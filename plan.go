@@ -0,0 +1,168 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// PlanFile is a file which a job would collect.
+type PlanFile struct {
+	Src       string   `json:"src"`
+	Dst       string   `json:"dst"`
+	Link      string   `json:"link,omitempty"`      // destination of a symlink copied as is
+	Checksums []string `json:"checksums,omitempty"` // checksum files to be generated
+	BeforeCmd []string `json:"before_cmd,omitempty"`
+	AfterCmd  []string `json:"after_cmd,omitempty"`
+}
+
+// Plan is what a job would do. It is made without touching dst or executing commands.
+type Plan struct {
+	Dst       string     `json:"dst"`
+	Files     []PlanFile `json:"files"`
+	Manifest  string     `json:"manifest,omitempty"`
+	BeforeCmd []string   `json:"before_cmd,omitempty"`
+	AfterCmd  []string   `json:"after_cmd,omitempty"`
+	OnSuccess []string   `json:"on_success,omitempty"`
+	OnFailure []string   `json:"on_failure,omitempty"` // ${error} is left as is
+	Finally   []string   `json:"finally,omitempty"`
+}
+
+// Plan interpolates, normalizes, checks and expands srcs as CopyAndExec does.
+// Destination paths and ${dst_root} are under DstDir, not the staging directory.
+func (j Job) Plan() (*Plan, error) {
+	resolved, err := j.Interpolate()
+	if err != nil {
+		return nil, err
+	}
+	j = *resolved
+
+	err = j.CheckConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	dst := filepath.Clean(j.DstDir)
+
+	srcs, err := j.Expand()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Plan{Dst: dst, Files: []PlanFile{}}
+	for _, v := range srcs {
+		err = v.Normalize(dst)
+		if err != nil {
+			return nil, fmt.Errorf("%s error:%s", v.Path, err)
+		}
+		err = v.checkSource(dst)
+		if err != nil {
+			return nil, fmt.Errorf("%s error:%s", v.Path, err)
+		}
+
+		f := PlanFile{Src: v.Path, Dst: v.DstPath, Link: v.linkTarget}
+		if !v.BeforeCmd.IsEmpty() {
+			f.BeforeCmd, err = v.BeforeCmdArgs()
+			if err != nil {
+				return nil, fmt.Errorf("%s error:%s", v.Path, err)
+			}
+		}
+		if !v.AfterCmd.IsEmpty() {
+			f.AfterCmd, err = v.AfterCmdArgs()
+			if err != nil {
+				return nil, fmt.Errorf("%s error:%s", v.Path, err)
+			}
+		}
+		if v.linkTarget == "" {
+			for _, c := range v.ChecksumType {
+				f.Checksums = append(f.Checksums, v.DstPath+"."+c)
+			}
+		}
+		ret.Files = append(ret.Files, f)
+	}
+
+	if j.Manifest != nil {
+		ret.Manifest = filepath.Join(dst, j.Manifest.FileName())
+	}
+	// files are staged in dst_root while running.
+	mp := j.placeholders(dst, dst)
+	for _, c := range []struct {
+		cmd  Command
+		argv *[]string
+	}{
+		{j.BeforeCmd, &ret.BeforeCmd},
+		{j.AfterCmd, &ret.AfterCmd},
+		{j.OnSuccess, &ret.OnSuccess},
+		{j.OnFailure, &ret.OnFailure},
+		{j.Finally, &ret.Finally},
+	} {
+		if !c.cmd.IsEmpty() {
+			*c.argv = c.cmd.Argv(mp)
+		}
+	}
+	return ret, nil
+}
+
+// Print writes the plan in human readable form.
+func (p Plan) Print(w io.Writer) {
+	for _, v := range p.Files {
+		if v.Link != "" {
+			fmt.Fprintf(w, "%s -> %s (symlink to %s)\n", v.Src, v.Dst, v.Link)
+		} else {
+			fmt.Fprintf(w, "%s -> %s\n", v.Src, v.Dst)
+		}
+		for _, c := range v.Checksums {
+			fmt.Fprintf(w, "  checksum: %s\n", c)
+		}
+		if len(v.BeforeCmd) > 0 {
+			fmt.Fprintf(w, "  before_cmd: %s\n", strings.Join(v.BeforeCmd, " "))
+		}
+		if len(v.AfterCmd) > 0 {
+			fmt.Fprintf(w, "  after_cmd: %s\n", strings.Join(v.AfterCmd, " "))
+		}
+	}
+	if p.Manifest != "" {
+		fmt.Fprintf(w, "manifest: %s\n", p.Manifest)
+	}
+	for _, c := range []struct {
+		name string
+		argv []string
+	}{
+		{"before_cmd", p.BeforeCmd},
+		{"after_cmd", p.AfterCmd},
+		{"on_success", p.OnSuccess},
+		{"on_failure", p.OnFailure},
+		{"finally", p.Finally},
+	} {
+		if len(c.argv) > 0 {
+			fmt.Fprintf(w, "%s: %s\n", c.name, strings.Join(c.argv, " "))
+		}
+	}
+}
+
+// PrintJSON writes the plan as JSON.
+func (p Plan) PrintJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent:%w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
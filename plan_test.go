@@ -0,0 +1,156 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJobPlan(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "jobplan")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	for _, v := range []string{"a.txt", "sub/b.txt", "c.md"} {
+		p := filepath.Join(srcdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	dst := filepath.Join(srcdir, "release")
+	marker := filepath.Join(srcdir, "executed")
+	j := &Job{DstDir: dst, Manifest: &Manifest{}, AfterCmd: Command{Args: []string{"touch", marker}},
+		OnFailure: Command{Args: []string{"echo", "${error}"}}, Finally: Command{Args: []string{"touch", marker}}}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(srcdir, "**/*.txt"), DstPath: "txt/", ChecksumType: ChecksumList{"md5"},
+		BeforeCmd: Command{Args: []string{"touch", marker}}, AfterCmd: Command{Args: []string{"test", "-f", "${target}"}}})
+	j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(srcdir, "c.md"), DstPath: "README.md"})
+
+	plan, err := j.Plan()
+	if err != nil {
+		t.Fatalf("Plan:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		src    string
+		dst    string
+		after  []string
+		checks []string
+	}
+	cases := []testcase{
+		{"glob", "a.txt", "txt/a.txt", []string{"test", "-f", filepath.Join(dst, "txt/a.txt")}, []string{filepath.Join(dst, "txt/a.txt.md5")}},
+		{"glob sub dir", "sub/b.txt", "txt/sub/b.txt", []string{"test", "-f", filepath.Join(dst, "txt/sub/b.txt")}, []string{filepath.Join(dst, "txt/sub/b.txt.md5")}},
+		{"rename", "c.md", "README.md", nil, nil},
+	}
+	if len(plan.Files) != len(cases) {
+		t.Fatalf("given %d files expect %d", len(plan.Files), len(cases))
+	}
+	for i, v := range cases {
+		f := plan.Files[i]
+		if f.Src != filepath.Join(srcdir, v.src) {
+			t.Errorf("%s:given %s expect %s", v.name, f.Src, filepath.Join(srcdir, v.src))
+		}
+		if f.Dst != filepath.Join(dst, v.dst) {
+			t.Errorf("%s:given %s expect %s", v.name, f.Dst, filepath.Join(dst, v.dst))
+		}
+		if !reflect.DeepEqual(f.AfterCmd, v.after) {
+			t.Errorf("%s:given %s expect %s", v.name, f.AfterCmd, v.after)
+		}
+		if !reflect.DeepEqual(f.Checksums, v.checks) {
+			t.Errorf("%s:given %s expect %s", v.name, f.Checksums, v.checks)
+		}
+	}
+	if plan.Manifest != filepath.Join(dst, "SHA256SUMS") {
+		t.Errorf("manifest:given %s", plan.Manifest)
+	}
+	if !reflect.DeepEqual(plan.OnFailure, []string{"echo", "${error}"}) {
+		t.Errorf("on_failure:given %s", plan.OnFailure)
+	}
+	if !reflect.DeepEqual(plan.Finally, []string{"touch", marker}) {
+		t.Errorf("finally:given %s", plan.Finally)
+	}
+
+	for _, v := range []string{dst, marker} {
+		if _, err := os.Stat(v); err == nil {
+			t.Errorf("%s should not be created", v)
+		}
+	}
+}
+
+func TestCliPlan(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "cliplan")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	src := filepath.Join(srcdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+	j := &Job{DstDir: filepath.Join(srcdir, "release"), Srcs: []*SrcFile{{Path: src, ChecksumType: ChecksumList{"sha1"}}}}
+	b, err := json.Marshal(j)
+	if err != nil {
+		t.Fatalf("Marshal:%s", err)
+	}
+	config := filepath.Join(srcdir, "config.json")
+	err = ioutil.WriteFile(config, b, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	cli := &CLI{OutStream: buf, ErrStream: buf, quiet: true}
+	ret := cli.Run([]string{"program-name", "plan", "-c", config})
+	if ret != ExitOK {
+		t.Fatalf("ret is not ExitOK, ret=%d %s", ret, buf.String())
+	}
+	expect := src + " -> " + filepath.Join(j.DstDir, "a.txt") + "\n"
+	if !strings.HasPrefix(buf.String(), expect) {
+		t.Errorf("given %s expect %s", buf.String(), expect)
+	}
+
+	buf.Reset()
+	ret = cli.Run([]string{"program-name", "plan", "-c", config, "-json"})
+	if ret != ExitOK {
+		t.Fatalf("ret is not ExitOK, ret=%d %s", ret, buf.String())
+	}
+	plan := &Plan{}
+	err = json.Unmarshal(buf.Bytes(), plan)
+	if err != nil {
+		t.Fatalf("Unmarshal:%s %s", err, buf.String())
+	}
+	if len(plan.Files) != 1 || plan.Files[0].Checksums[0] != filepath.Join(j.DstDir, "a.txt.sha1") {
+		t.Errorf("given %v", plan.Files)
+	}
+}
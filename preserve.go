@@ -0,0 +1,99 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Attributes to preserve
+const (
+	PreserveMode       = "mode"
+	PreserveTimestamps = "timestamps" // mtime and atime
+	PreserveOwnership  = "ownership"  // uid and gid. only when privileged
+	PreserveXattrs     = "xattrs"     // extended attributes
+)
+
+// defaultPreserve is used when preserve is not specified.
+var defaultPreserve = []string{PreserveMode}
+
+// CheckPreserve checks attribute names.
+func CheckPreserve(list []string) error {
+	for _, v := range list {
+		switch v {
+		case PreserveMode, PreserveTimestamps, PreserveOwnership, PreserveXattrs:
+		default:
+			return fmt.Errorf("preserve: unknown attribute %s", v)
+		}
+	}
+	return nil
+}
+
+func hasAttribute(list []string, name string) bool {
+	for _, v := range list {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PreserveAttributes copies attributes of src to dst.
+func PreserveAttributes(src string, dst string, list []string) error {
+	if len(list) == 0 {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	// chown may clear setuid bits. Change ownership before mode.
+	if hasAttribute(list, PreserveOwnership) && os.Geteuid() == 0 {
+		uid, gid, ok := fileOwner(info)
+		if ok {
+			err = os.Lchown(dst, uid, gid)
+			if err != nil {
+				return fmt.Errorf("chown:%w", err)
+			}
+		}
+	}
+
+	if hasAttribute(list, PreserveXattrs) {
+		err = copyXattrs(src, dst)
+		if err != nil {
+			return fmt.Errorf("xattrs:%w", err)
+		}
+	}
+
+	if hasAttribute(list, PreserveMode) {
+		mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		err = os.Chmod(dst, mode)
+		if err != nil {
+			return fmt.Errorf("chmod:%w", err)
+		}
+	}
+
+	if hasAttribute(list, PreserveTimestamps) {
+		err = os.Chtimes(dst, fileAtime(info), info.ModTime())
+		if err != nil {
+			return fmt.Errorf("chtimes:%w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func fileAtime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+}
+
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// xattrUnsupported reports whether err means the attribute can't be copied.
+// e.g. the file system doesn't support xattrs or a non user namespace requires privilege.
+func xattrUnsupported(name string, err error) bool {
+	if err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP {
+		return true
+	}
+	return err == syscall.EPERM && !strings.HasPrefix(name, "user.")
+}
+
+func copyXattrs(src string, dst string) error {
+	sz, err := syscall.Listxattr(src, nil)
+	if err != nil {
+		if xattrUnsupported("", err) {
+			return nil
+		}
+		return err
+	}
+	if sz == 0 {
+		return nil
+	}
+	buf := make([]byte, sz)
+	sz, err = syscall.Listxattr(src, buf)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range bytes.Split(buf[:sz], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n := string(name)
+		vsz, err := syscall.Getxattr(src, n, nil)
+		if err != nil {
+			return err
+		}
+		val := make([]byte, vsz)
+		if vsz > 0 {
+			vsz, err = syscall.Getxattr(src, n, val)
+			if err != nil {
+				return err
+			}
+		}
+		err = syscall.Setxattr(dst, n, val[:vsz], 0)
+		if err != nil && !xattrUnsupported(n, err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckPreserve(t *testing.T) {
+	err := CheckPreserve([]string{PreserveMode, PreserveTimestamps, PreserveOwnership, PreserveXattrs})
+	if err != nil {
+		t.Errorf("CheckPreserve:%s", err)
+	}
+	err = CheckPreserve([]string{"unknown"})
+	if err == nil {
+		t.Errorf("unknown should be error")
+	}
+}
+
+func TestSrcFilePreserve(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "preserve")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.sh")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+	err = os.Chmod(src, 0750)
+	if err != nil {
+		t.Fatalf("Chmod:%s", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = os.Chtimes(src, mtime, mtime)
+	if err != nil {
+		t.Fatalf("Chtimes:%s", err)
+	}
+
+	type testcase struct {
+		name      string
+		preserve  []string
+		after     Command
+		mode      bool
+		timestamp bool
+	}
+
+	cases := []testcase{
+		{"default", nil, Command{}, true, false},
+		{"nothing", []string{}, Command{}, false, false},
+		{"timestamps", []string{PreserveTimestamps}, Command{}, false, true},
+		{"all", []string{PreserveMode, PreserveTimestamps, PreserveOwnership, PreserveXattrs}, Command{}, true, true},
+		{"after_cmd", []string{PreserveMode, PreserveTimestamps}, Command{Args: []string{"sh", "-c", "chmod 600 ${target} && touch ${target}"}}, true, true},
+	}
+
+	for i, v := range cases {
+		outRoot := filepath.Join(tmpdir, "out", string('a'+rune(i)))
+		err = os.MkdirAll(outRoot, 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+
+		s := &SrcFile{Path: src, Preserve: v.preserve, AfterCmd: v.after}
+		err = s.CopyAndExec(outRoot)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+
+		info, err := os.Stat(s.DstPath)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if (info.Mode().Perm() == 0750) != v.mode {
+			t.Errorf("%s:mode given %s", v.name, info.Mode())
+		}
+		if info.ModTime().Equal(mtime) != v.timestamp {
+			t.Errorf("%s:mtime given %s", v.name, info.ModTime())
+		}
+	}
+}
+
+func TestSrcFilePreserveRemoved(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "preserveremoved")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+	outRoot := filepath.Join(tmpdir, "out")
+	err = os.Mkdir(outRoot, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir:%s", err)
+	}
+
+	// after_cmd replaces the file like gzip.
+	s := &SrcFile{Path: src, Preserve: []string{PreserveMode}, AfterCmd: Command{Args: []string{"mv", "${target}", "${target}.old"}}}
+	err = s.CopyAndExec(outRoot)
+	if err != nil {
+		t.Errorf("CopyAndExec:%s", err)
+	}
+}
@@ -0,0 +1,270 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Policies when dst already exists
+const (
+	OnExistingFail    = "fail"    // default
+	OnExistingReplace = "replace" // swap dst and remove the old tree
+	OnExistingBackup  = "backup"  // rename the old tree with a timestamp suffix
+	OnExistingMerge   = "merge"   // add files into the old tree
+)
+
+// BackupSuffixFormat is a time format of the suffix of a backup.
+const BackupSuffixFormat = "20060102-150405"
+
+// errExchangeNotSupported is returned by renameExchange if the platform can't swap paths atomically.
+var errExchangeNotSupported = errors.New("exchange is not supported")
+
+// rename, exchange and now are replaced for testing.
+var (
+	rename   = os.Rename
+	exchange = renameExchange
+	now      = time.Now
+)
+
+// CheckOnExisting checks a policy name. A blank means default.
+func CheckOnExisting(policy string) error {
+	switch policy {
+	case "", OnExistingFail, OnExistingReplace, OnExistingBackup, OnExistingMerge:
+		return nil
+	}
+	return fmt.Errorf("on_existing: unknown policy %s", policy)
+}
+
+// exists reports whether path exists. A dangling symlink exists.
+func exists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// PublishTo moves the staged tree src to dst according to policy if dst exists.
+func PublishTo(src string, dst string, policy string) error {
+	dst = filepath.Clean(dst)
+	ok, err := exists(dst)
+	if err != nil {
+		return err
+	} else if !ok {
+		return Publish(src, dst)
+	}
+
+	switch policy {
+	case OnExistingReplace, OnExistingBackup:
+		old := ""
+		if policy == OnExistingBackup {
+			old = dst + "." + now().Format(BackupSuffixFormat)
+			ok, err = exists(old)
+			if err != nil {
+				return err
+			} else if ok {
+				return fmt.Errorf("backup %s already exists", old)
+			}
+		}
+
+		// place the new tree next to dst at first since it may be copied across file systems.
+		tmpdir, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".new")
+		if err != nil {
+			return fmt.Errorf("Tempdir:%w", err)
+		}
+		defer os.RemoveAll(tmpdir)
+		next := filepath.Join(tmpdir, "root")
+		err = Publish(src, next)
+		if err != nil {
+			return err
+		}
+		if old == "" {
+			old = filepath.Join(tmpdir, "old")
+		}
+		return swap(next, dst, old)
+	case OnExistingMerge:
+		return MergeTree(src, dst)
+	}
+	return fmt.Errorf("%s already exists", dst)
+}
+
+// swap replaces dst with next on the same file system and moves the old tree to old.
+// dst is exchanged atomically on Linux. Otherwise, or if the file system doesn't support it,
+// dst is renamed twice and it doesn't exist for a moment between them.
+// If it fails, dst is restored.
+func swap(next string, dst string, old string) error {
+	err := exchange(next, dst)
+	if err == nil {
+		err = rename(next, old)
+		if err != nil {
+			if rberr := exchange(next, dst); rberr != nil {
+				return fmt.Errorf("%s. rollback failed:%s", err, rberr)
+			}
+			return err
+		}
+		return nil
+	} else if err != errExchangeNotSupported {
+		return err
+	}
+
+	err = rename(dst, old)
+	if err != nil {
+		return err
+	}
+	err = rename(next, dst)
+	if err != nil {
+		if rberr := rename(old, dst); rberr != nil {
+			return fmt.Errorf("%s. rollback failed:%s", err, rberr)
+		}
+		return err
+	}
+	return nil
+}
+
+// MergeTree moves files of the directory src into dst.
+// Existing files are replaced and other files of dst are kept.
+func MergeTree(src string, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			dinfo, err := os.Stat(target)
+			if os.IsNotExist(err) {
+				return os.Mkdir(target, info.Mode().Perm())
+			} else if err != nil {
+				return err
+			} else if !dinfo.IsDir() {
+				return fmt.Errorf("%s is not a directory", target)
+			}
+			return nil
+		}
+
+		if dinfo, err := os.Lstat(target); err == nil && dinfo.IsDir() {
+			return fmt.Errorf("%s is a directory", target)
+		}
+		return moveFile(p, target)
+	})
+}
+
+// moveFile replaces dst with src.
+// If they are on different file systems, src is copied next to dst and renamed.
+func moveFile(src string, dst string) error {
+	err := rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	tmpdir, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".copy")
+	if err != nil {
+		return fmt.Errorf("Tempdir:%w", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tmp := filepath.Join(tmpdir, filepath.Base(dst))
+	err = CopyTree(src, tmp)
+	if err != nil {
+		return err
+	}
+	return rename(tmp, dst)
+}
+
+// isCrossDevice reports whether err is EXDEV of rename(2).
+func isCrossDevice(err error) bool {
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		return le.Err == syscall.EXDEV
+	}
+	return false
+}
+
+// Publish moves the staged tree src to dst.
+// If src and dst are on different file systems, src is copied next to dst at first
+// and then renamed to dst. dst appears all at once in both cases.
+func Publish(src string, dst string) error {
+	err := rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	dst = filepath.Clean(dst)
+	tmpdir, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".copy")
+	if err != nil {
+		return fmt.Errorf("Tempdir:%w", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tmproot := filepath.Join(tmpdir, "root")
+	err = CopyTree(src, tmproot)
+	if err != nil {
+		return fmt.Errorf("CopyTree:%w", err)
+	}
+	return rename(tmproot, dst)
+}
+
+// CopyTree copies the directory src to dst recursively.
+// Mode, timestamps, ownership, extended attributes and symlinks are kept.
+func CopyTree(src string, dst string) error {
+	all := []string{PreserveMode, PreserveTimestamps, PreserveOwnership, PreserveXattrs}
+
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		s := &SrcFile{Path: p, DstPath: filepath.Join(dst, rel), Preserve: all}
+
+		switch {
+		case info.IsDir():
+			err = os.Mkdir(s.DstPath, 0755)
+			if err != nil {
+				return err
+			}
+			return PreserveAttributes(p, s.DstPath, []string{PreserveMode, PreserveOwnership})
+		case isSymlink(info):
+			s.linkTarget, err = os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return s.copyLink()
+		}
+
+		err = s.CopyFile()
+		if err != nil {
+			return err
+		}
+		return PreserveAttributes(p, s.DstPath, all)
+	})
+}
@@ -0,0 +1,428 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func createPublishTree(t *testing.T, root string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll:%s", err)
+	}
+	for _, v := range []string{"a.sh", "sub/b.txt"} {
+		err = createTxtFile(t, filepath.Join(root, v))
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+	err = os.Chmod(filepath.Join(root, "a.sh"), 0750)
+	if err != nil {
+		t.Fatalf("Chmod:%s", err)
+	}
+	err = os.Symlink("a.sh", filepath.Join(root, "link"))
+	if err != nil {
+		t.Skipf("Symlink:%s", err)
+	}
+}
+
+func checkPublishTree(t *testing.T, root string) {
+	t.Helper()
+
+	for _, v := range []string{"a.sh", "sub/b.txt"} {
+		_, err := os.Stat(filepath.Join(root, v))
+		if err != nil {
+			t.Errorf("%s:%s", v, err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(root, "a.sh"))
+	if err == nil && info.Mode().Perm() != 0750 {
+		t.Errorf("mode is not kept:%s", info.Mode())
+	}
+	target, err := os.Readlink(filepath.Join(root, "link"))
+	if err != nil || target != "a.sh" {
+		t.Errorf("symlink is not kept:%s %s", target, err)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "copytree")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src")
+	createPublishTree(t, src)
+
+	dst := filepath.Join(tmpdir, "dst")
+	err = CopyTree(src, dst)
+	if err != nil {
+		t.Fatalf("CopyTree:%s", err)
+	}
+	checkPublishTree(t, dst)
+}
+
+func TestPublishCrossDevice(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "publish")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src")
+	createPublishTree(t, src)
+
+	// emulate the first rename across file systems
+	calls := 0
+	rename = func(oldpath, newpath string) error {
+		calls++
+		if calls == 1 {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	defer func() { rename = os.Rename }()
+
+	dst := filepath.Join(tmpdir, "dst")
+	err = Publish(src, dst)
+	if err != nil {
+		t.Fatalf("Publish:%s", err)
+	}
+	if calls != 2 {
+		t.Errorf("rename is called %d times", calls)
+	}
+	checkPublishTree(t, dst)
+
+	// temporary copy should be removed
+	files, err := ioutil.ReadDir(tmpdir)
+	if err != nil {
+		t.Fatalf("ReadDir:%s", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("given %d files expect src and dst", len(files))
+	}
+}
+
+func TestJobCopyAndExecStaging(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "staging")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.txt")
+	err = createTxtFile(t, src)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	staged := ""
+	rename = func(oldpath, newpath string) error {
+		staged = oldpath
+		return os.Rename(oldpath, newpath)
+	}
+	defer func() { rename = os.Rename }()
+
+	type testcase struct {
+		name    string
+		staging string
+		expect  string
+	}
+
+	cases := []testcase{
+		{"default", "", filepath.Join(tmpdir, "out")},
+		{"staging", filepath.Join(tmpdir, "stage"), filepath.Join(tmpdir, "stage")},
+	}
+
+	for _, v := range cases {
+		j := &Job{DstDir: filepath.Join(tmpdir, "out", v.name) + "/", Staging: v.staging}
+		j.Srcs = append(j.Srcs, &SrcFile{Path: src})
+		err = j.CopyAndExec(ioutil.Discard, ioutil.Discard)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if filepath.Dir(filepath.Dir(staged)) != v.expect {
+			t.Errorf("%s:staged in %s expect %s", v.name, staged, v.expect)
+		}
+	}
+}
+
+// listTree returns "path:content" of files under root.
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+
+	ret := []string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, filepath.ToSlash(rel)+":"+string(b))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk:%s", err)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for k, v := range files {
+		p := filepath.Join(root, k)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = ioutil.WriteFile(p, []byte(v), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile:%s", err)
+		}
+	}
+}
+
+func TestPublishTo(t *testing.T) {
+	now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	type testcase struct {
+		name    string
+		policy  string
+		success bool
+		expect  []string // files of the parent of dst
+	}
+
+	cases := []testcase{
+		{"fail", OnExistingFail, false,
+			[]string{"dst/a.txt:old", "dst/old.txt:old", "src/a.txt:new", "src/sub/b.txt:new"}},
+		{"default", "", false,
+			[]string{"dst/a.txt:old", "dst/old.txt:old", "src/a.txt:new", "src/sub/b.txt:new"}},
+		{"replace", OnExistingReplace, true,
+			[]string{"dst/a.txt:new", "dst/sub/b.txt:new"}},
+		{"backup", OnExistingBackup, true,
+			[]string{"dst.20200102-030405/a.txt:old", "dst.20200102-030405/old.txt:old", "dst/a.txt:new", "dst/sub/b.txt:new"}},
+		{"merge", OnExistingMerge, true,
+			[]string{"dst/a.txt:new", "dst/old.txt:old", "dst/sub/b.txt:new"}},
+	}
+
+	for _, v := range cases {
+		tmpdir, err := ioutil.TempDir("", "publishto")
+		if err != nil {
+			t.Fatalf("TempDir:%s", err)
+		}
+		writeTree(t, filepath.Join(tmpdir, "src"), map[string]string{"a.txt": "new", "sub/b.txt": "new"})
+		writeTree(t, filepath.Join(tmpdir, "dst"), map[string]string{"a.txt": "old", "old.txt": "old"})
+
+		err = PublishTo(filepath.Join(tmpdir, "src"), filepath.Join(tmpdir, "dst"), v.policy)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+
+		given := listTree(t, tmpdir)
+		if strings.Join(given, ",") != strings.Join(v.expect, ",") {
+			t.Errorf("%s:mismatch\n given= %v\n expect=%v", v.name, given, v.expect)
+		}
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func TestPublishToNotExist(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "publishto")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, v := range []string{OnExistingFail, OnExistingReplace, OnExistingBackup, OnExistingMerge} {
+		src := filepath.Join(tmpdir, v, "src")
+		dst := filepath.Join(tmpdir, v, "dst")
+		writeTree(t, src, map[string]string{"a.txt": "new"})
+		err = PublishTo(src, dst, v)
+		if err != nil {
+			t.Errorf("%s:%s", v, err)
+			continue
+		}
+		given := listTree(t, filepath.Join(tmpdir, v))
+		if strings.Join(given, ",") != "dst/a.txt:new" {
+			t.Errorf("%s:given %v", v, given)
+		}
+	}
+}
+
+func TestPublishToRollback(t *testing.T) {
+	type testcase struct {
+		name     string
+		exchange func(string, string) error
+		failAt   int // rename which fails
+	}
+
+	cases := []testcase{
+		// Publish, rename next to old
+		{"exchange", renameExchange, 2},
+		// Publish, rename dst to old, rename next to dst
+		{"rename", func(string, string) error { return errExchangeNotSupported }, 3},
+	}
+	defer func() {
+		rename = os.Rename
+		exchange = renameExchange
+	}()
+
+	for _, v := range cases {
+		tmpdir, err := ioutil.TempDir("", "publishto")
+		if err != nil {
+			t.Fatalf("TempDir:%s", err)
+		}
+		defer os.RemoveAll(tmpdir)
+
+		writeTree(t, filepath.Join(tmpdir, "src"), map[string]string{"a.txt": "new"})
+		writeTree(t, filepath.Join(tmpdir, "dst"), map[string]string{"a.txt": "old"})
+
+		// fail to publish after the old tree is moved
+		calls := 0
+		failAt := v.failAt
+		rename = func(oldpath, newpath string) error {
+			calls++
+			if calls == failAt {
+				return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EACCES}
+			}
+			return os.Rename(oldpath, newpath)
+		}
+		exchange = v.exchange
+
+		err = PublishTo(filepath.Join(tmpdir, "src"), filepath.Join(tmpdir, "dst"), OnExistingReplace)
+		if err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+		given := listTree(t, filepath.Join(tmpdir, "dst"))
+		if strings.Join(given, ",") != "a.txt:old" {
+			t.Errorf("%s:old tree is not restored:%v", v.name, given)
+		}
+	}
+}
+
+func TestPublishToReplaceCrossDevice(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "publishto")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src")
+	dst := filepath.Join(tmpdir, "dst")
+	writeTree(t, src, map[string]string{"a.txt": "new"})
+	writeTree(t, dst, map[string]string{"a.txt": "old"})
+
+	// emulate the staging directory on another file system.
+	// dst should be kept until the copy is renamed next to dst.
+	calls := 0
+	rename = func(oldpath, newpath string) error {
+		calls++
+		if calls <= 2 {
+			b, err := ioutil.ReadFile(filepath.Join(dst, "a.txt"))
+			if err != nil || string(b) != "old" {
+				t.Errorf("dst is not kept while copying:%s %s", b, err)
+			}
+		}
+		if calls == 1 {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	defer func() { rename = os.Rename }()
+
+	err = PublishTo(src, dst, OnExistingReplace)
+	if err != nil {
+		t.Fatalf("PublishTo:%s", err)
+	}
+	given := listTree(t, tmpdir)
+	if strings.Join(given, ",") != "dst/a.txt:new,src/a.txt:new" {
+		t.Errorf("given %v", given)
+	}
+}
+
+func TestMergeTreeConflict(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "mergetree")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	writeTree(t, filepath.Join(tmpdir, "src"), map[string]string{"a": "new"})
+	writeTree(t, filepath.Join(tmpdir, "dst"), map[string]string{"a/b.txt": "old"})
+
+	err = MergeTree(filepath.Join(tmpdir, "src"), filepath.Join(tmpdir, "dst"))
+	if err == nil {
+		t.Errorf("replacing a directory with a file should be error")
+	}
+}
+
+func TestJobCopyAndExecOnExisting(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "onexisting")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "a.txt")
+	writeTree(t, tmpdir, map[string]string{"a.txt": "new", "release/old.txt": "old"})
+
+	j := &Job{DstDir: filepath.Join(tmpdir, "release")}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: src})
+	err = j.CopyAndExec(ioutil.Discard, ioutil.Discard)
+	if err == nil {
+		t.Errorf("existing dst should be error")
+	}
+
+	j.OnExisting = OnExistingMerge
+	err = j.CopyAndExec(ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		t.Errorf("merge:%s", err)
+	}
+	given := listTree(t, j.DstDir)
+	if strings.Join(given, ",") != "a.txt:new,old.txt:old" {
+		t.Errorf("merge:given %v", given)
+	}
+
+	j.OnExisting = "unknown"
+	err = j.CopyAndExec(ioutil.Discard, ioutil.Discard)
+	if err == nil {
+		t.Errorf("unknown policy should be error")
+	}
+}
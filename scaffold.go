@@ -0,0 +1,70 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// ExampleConfig is a config file created by init command.
+const ExampleConfig = `// file-collector config file.
+// "//" starts a comment.
+{
+    // files to collect
+    "srcs": [
+        {
+            // a file, a directory or a glob pattern like "src/**/*.txt"
+            "path": "src/hoge.txt",
+            // hoge.txt.sha1 is created. e.g. "md5", ["sha1", "sha256"]
+            "checksum": "sha1"
+        },
+        {
+            "path": "src/a.txt",
+            // path under dst. A trailing "/" means a directory.
+            "dst_path": "b.txt",
+            // commands before/after copying. ${target} is replaced with the source/copied file.
+            "before_cmd": ["test", "-f", "${target}"],
+            "after_cmd": ["chmod", "644", "${target}"]
+        }
+    ],
+    // output directory
+    "dst": "release/",
+    // "fail", "replace", "backup" or "merge" if dst already exists
+    "on_existing": "fail",
+    // SHA256SUMS of all files is created under dst
+    "manifest": {"algorithm": "sha256"}
+}
+`
+
+// WriteExampleConfig creates ExampleConfig at path.
+// An existing file is overwritten only if force is true.
+func WriteExampleConfig(path string, force bool) error {
+	if !force {
+		ok, err := exists(path)
+		if err != nil {
+			return err
+		} else if ok {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+	err := ioutil.WriteFile(path, []byte(ExampleConfig), 0644)
+	if err != nil {
+		return fmt.Errorf("ioutil.WriteFile:%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExampleConfig(t *testing.T) {
+	j, err := DecodeJob([]byte(ExampleConfig))
+	if err != nil {
+		t.Fatalf("DecodeJob:%s", err)
+	}
+	err = j.CheckConfiguration()
+	if err != nil {
+		t.Errorf("CheckConfiguration:%s", err)
+	}
+	if len(j.Srcs) != 2 || j.DstDir != "release/" {
+		t.Errorf("given %v", j)
+	}
+}
+
+func TestWriteExampleConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+
+	type testcase struct {
+		name    string
+		force   bool
+		success bool
+	}
+	cases := []testcase{
+		{"create", false, true},
+		{"exists", false, false},
+		{"force", true, true},
+	}
+
+	for _, v := range cases {
+		err = WriteExampleConfig(path, v.force)
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile:%s", err)
+	}
+	if string(b) != ExampleConfig {
+		t.Errorf("given %s", string(b))
+	}
+}
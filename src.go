@@ -17,11 +17,9 @@
 package main
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
+	"bytes"
+	"encoding/hex"
 	"fmt"
-	"hash"
 	"io"
 	"io/ioutil"
 	"os"
@@ -30,20 +28,33 @@ import (
 	"sync"
 )
 
-var sumList sync.Map
+type SrcFile struct {
+	Path             string       `json:"path"`
+	DstPath          string       `json:"dst_path"`                    // relative file path
+	ChecksumType     ChecksumList `json:"checksum,omitempty"`          // string or array of string
+	ExpectedChecksum string       `json:"expected_checksum,omitempty"` // e.g. "sha256:<hex>"
+	BeforeCmd        Command      `json:"before_cmd,omitempty"`
+	AfterCmd         Command      `json:"after_cmd,omitempty"`
+	Include          []string     `json:"include,omitempty"`     // patterns for directory or glob sources
+	Exclude          []string     `json:"exclude,omitempty"`     // patterns for directory or glob sources
+	IgnoreFile       string       `json:"ignore_file,omitempty"` // .gitignore style file
+	Verify           bool         `json:"verify,omitempty"`      // compare source and destination after copying
+	Preserve         []string     `json:"preserve,omitempty"`    // attributes to preserve. default: mode
+	Symlinks         string       `json:"symlinks,omitempty"`    // follow(default), preserve, skip or error
+	SymlinkRoot      string       `json:"symlink_root,omitempty"` // symlinks must point under it
 
-func init() {
-	sumList.Store("sha256", sha256.New())
-	sumList.Store("sha1", sha1.New())
-	sumList.Store("md5", md5.New())
+	sums       map[string][]byte // checksums of DstPath calculated by CopyAndExec
+	linkTarget string            // not blank if the source is copied as a symlink
+	root       string            // root directory of normalized DstPath
+	jobName    string            // for ${job_name}
+	logDir     string            // directory of log files of hooks
+	hookLock   sync.Locker       // serializes hooks of srcs copied in parallel
+	srcSum     string            // hex checksum of the source for ${checksum} calculated while copying
 }
 
-type SrcFile struct {
-	Path         string   `json:"path"`
-	DstPath      string   `json:"dst_path"` // relative file path
-	ChecksumType string   `json:"checksum,omitempty"`
-	BeforeCmd    []string `json:"before_cmd",omitempty`
-	AfterCmd     []string `json:"after_cmd",omitempty`
+// UnmarshalJSON decodes the object strictly and reports positions of errors.
+func (i *SrcFile) UnmarshalJSON(b []byte) error {
+	return decodeObject(b, i)
 }
 
 func (i SrcFile) String() string {
@@ -60,11 +71,21 @@ func IsSubDir(root string, path string) bool {
 	if err != nil {
 		return false
 	}
-	//	fmt.Printf("absPath:%s\nabsRoot:%s\n", absPath, absRoot)
-	return strings.HasPrefix(absPath, absRoot)
+	// "/x/data-evil" is not under "/x/data".
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func (i SrcFile) CopyFile() error {
+	return i.copyFile(nil)
+}
+
+// copyFile copies Path to DstPath.
+// If w is not nil, the copied data is also written to w in the same pass.
+func (i SrcFile) copyFile(w io.Writer) error {
 	src, err := os.Open(i.Path)
 	if err != nil {
 		return fmt.Errorf("src open:%w", err)
@@ -76,7 +97,7 @@ func (i SrcFile) CopyFile() error {
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(filepath.Dir(i.DstPath), 0744)
 		if err != nil {
-			return nil
+			return err
 		}
 	}
 
@@ -84,66 +105,201 @@ func (i SrcFile) CopyFile() error {
 	if err != nil {
 		return fmt.Errorf("dst create:%w", err)
 	}
-	defer dst.Close()
-	_, err = io.Copy(dst, src)
-	return err
+	var out io.Writer = dst
+	if w != nil {
+		out = io.MultiWriter(dst, w)
+	}
+	_, err = io.Copy(out, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
 }
 
 func (i SrcFile) ExecBeforeCmd(out io.Writer, err io.Writer) error {
-	mp := map[string]string{"${target}": i.Path}
+	sum, e := i.sourceChecksum()
+	if e != nil {
+		return e
+	}
+	mp := i.placeholders(i.Path, sum)
+	if i.hookLock != nil {
+		i.hookLock.Lock()
+		defer i.hookLock.Unlock()
+	}
 	return execCommand(mp, i.BeforeCmd, out, err)
 }
 
 func (i SrcFile) ExecAfterCmd(out io.Writer, err io.Writer) error {
-	mp := map[string]string{"${target}": i.DstPath}
+	// the digest is calculated while copying.
+	sum := i.srcSum
+	if sum == "" {
+		var e error
+		sum, e = i.sourceChecksum()
+		if e != nil {
+			return e
+		}
+	}
+	mp := i.placeholders(i.DstPath, sum)
+	if i.hookLock != nil {
+		i.hookLock.Lock()
+		defer i.hookLock.Unlock()
+	}
 	return execCommand(mp, i.AfterCmd, out, err)
 }
 
-func (i SrcFile) Checksum(path string) ([]byte, error) {
-	l, ok := sumList.Load(i.ChecksumType)
-	if !ok {
-		return nil, fmt.Errorf("Unknown checksum :%s", i.ChecksumType)
+// BeforeCmdArgs returns before_cmd whose placeholders are replaced.
+// ${target} is the source.
+func (i SrcFile) BeforeCmdArgs() ([]string, error) {
+	return i.cmdArgs(i.Path, i.BeforeCmd)
+}
+
+// AfterCmdArgs returns after_cmd whose placeholders are replaced.
+// ${target} is the copied file.
+func (i SrcFile) AfterCmdArgs() ([]string, error) {
+	return i.cmdArgs(i.DstPath, i.AfterCmd)
+}
+
+// cmdArgs returns arguments of c executed on target.
+// The source is read only if arguments have ${checksum} since commands are not executed.
+func (i SrcFile) cmdArgs(target string, c Command) ([]string, error) {
+	sum := ""
+	if strings.Contains(strings.Join(c.Args, " "), "${checksum}") {
+		var err error
+		sum, err = i.sourceChecksum()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Argv(i.placeholders(target, sum)), nil
+}
+
+// placeholders returns values of placeholders for commands executed on target.
+// They are also passed as environment variables like FC_SRC.
+// checksum is the hex checksum of the source.
+func (i SrcFile) placeholders(target string, checksum string) map[string]string {
+	return map[string]string{
+		"${target}":   target,
+		"${src}":      i.Path,
+		"${dst}":      i.DstPath,
+		"${basename}": filepath.Base(target),
+		"${dirname}":  filepath.Dir(target),
+		"${ext}":      filepath.Ext(target),
+		"${checksum}": checksum,
+		"${dst_root}": i.root,
+		"${job_name}": i.jobName,
 	}
-	h, ok := l.(hash.Hash)
-	if !ok {
-		return nil, fmt.Errorf("Not hash.Hash. %v", h)
+}
+
+// sourceChecksum returns the hex checksum of the source for ${checksum}.
+// The copied file is the same as the source until after_cmd is executed.
+// It is blank if the source doesn't exist yet or is not a regular file.
+func (i SrcFile) sourceChecksum() (string, error) {
+	if i.linkTarget != "" {
+		return "", nil
+	}
+	info, err := os.Stat(i.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("checksum:%w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil
 	}
 
-	b, err := ioutil.ReadFile(path)
+	alg := i.verifyAlgorithm()
+	sums, err := ChecksumFile(i.Path, []string{alg})
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("checksum:%w", err)
 	}
-	h.Reset()
-	n, err := h.Write(b)
+	return hex.EncodeToString(sums[alg]), nil
+}
+
+func (i SrcFile) newHash() (*MultiHash, error) {
+	if len(i.ChecksumType) == 0 {
+		return nil, fmt.Errorf("checksum is not specified")
+	}
+	return NewMultiHash(i.ChecksumType)
+}
+
+// Checksum calculates checksums of path for each ChecksumType in one read.
+// The file is read in a streaming way to keep memory usage flat.
+func (i SrcFile) Checksum(path string) (map[string][]byte, error) {
+	if len(i.ChecksumType) == 0 {
+		return nil, fmt.Errorf("checksum is not specified")
+	}
+	return ChecksumFile(path, i.ChecksumType)
+}
+
+// ChecksumStr returns hex encoded checksums keyed by algorithm name.
+func (i SrcFile) ChecksumStr(path string) (map[string]string, error) {
+	sums, err := i.Checksum(path)
 	if err != nil {
 		return nil, err
-	} else if n < len(b) {
-		return nil, fmt.Errorf("calc sum size error n=%d", n)
 	}
+	ret := make(map[string]string)
+	for k, v := range sums {
+		ret[k] = fmt.Sprintf("%x", v)
+	}
+	return ret, nil
+}
 
-	return h.Sum(nil), nil
+// parseExpectedChecksum splits ExpectedChecksum into an algorithm and a hex string.
+func (i SrcFile) parseExpectedChecksum() (string, string, error) {
+	idx := strings.Index(i.ExpectedChecksum, ":")
+	if idx < 0 {
+		return "", "", fmt.Errorf("expected_checksum:%s should be <algorithm>:<hex>", i.ExpectedChecksum)
+	}
+	alg := i.ExpectedChecksum[:idx]
+	sum := strings.ToLower(i.ExpectedChecksum[idx+1:])
+	_, err := NewHash(alg)
+	if err != nil {
+		return "", "", fmt.Errorf("expected_checksum:%w", err)
+	}
+	_, err = hex.DecodeString(sum)
+	if err != nil || sum == "" {
+		return "", "", fmt.Errorf("expected_checksum:%s is not a hex string", sum)
+	}
+	return alg, sum, nil
 }
 
-func (i SrcFile) ChecksumStr(path string) (string, error) {
-	b, err := i.Checksum(path)
+// VerifySource checks that Path matches ExpectedChecksum.
+func (i SrcFile) VerifySource() error {
+	if i.ExpectedChecksum == "" {
+		return nil
+	}
+	alg, _, err := i.parseExpectedChecksum()
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	s := i
+	s.ChecksumType = ChecksumList{alg}
+	sums, err := s.Checksum(i.Path)
+	if err != nil {
+		return fmt.Errorf("expected_checksum:%w", err)
 	}
-	return fmt.Sprintf("%x", b), nil
+	return i.matchExpected(sums[alg])
 }
 
-// CheckConditions checks configuration
-//   src should be a file.
-//   dst root should be a directory.
-func (i *SrcFile) CheckConfiguration(outRoot string) error {
-	srcinfo, err := os.Stat(i.Path)
+// matchExpected checks that sum of the algorithm of ExpectedChecksum matches it.
+func (i SrcFile) matchExpected(sum []byte) error {
+	alg, expect, err := i.parseExpectedChecksum()
 	if err != nil {
 		return err
 	}
-	if srcinfo.IsDir() {
-		return fmt.Errorf("SrcPath is a directory")
+	given := hex.EncodeToString(sum)
+	if given != expect {
+		return fmt.Errorf("%s: %s mismatch\n given= %s\n expect=%s", i.Path, alg, given, expect)
 	}
+	return nil
+}
 
+// CheckConditions checks configuration
+//   src should be a file.
+//   dst root should be a directory.
+func (i *SrcFile) CheckConfiguration(outRoot string) error {
 	outrootinfo, err := os.Stat(outRoot)
 	if err != nil {
 		return fmt.Errorf("stat(outroot):%w", err)
@@ -151,11 +307,207 @@ func (i *SrcFile) CheckConfiguration(outRoot string) error {
 	if !outrootinfo.IsDir() {
 		return fmt.Errorf("dstRoot is a file")
 	}
+	return i.checkSource(outRoot)
+}
+
+// checkSource checks configuration except for outRoot itself.
+// outRoot may not exist yet.
+func (i *SrcFile) checkSource(outRoot string) error {
+	stat := os.Stat
+	if i.linkTarget != "" {
+		stat = os.Lstat
+	}
+	srcinfo, err := stat(i.Path)
+	if err != nil {
+		return err
+	}
+	if srcinfo.IsDir() {
+		return fmt.Errorf("SrcPath is a directory")
+	}
+	// a symlink has no content to hash.
+	if i.linkTarget != "" && (len(i.ChecksumType) > 0 || i.ExpectedChecksum != "" || i.Verify) {
+		return fmt.Errorf("symlink %s can't be checked by checksum, expected_checksum or verify", i.Path)
+	}
 
 	if !IsSubDir(outRoot, i.DstPath) {
 		return fmt.Errorf("DstPath:%s is outside of root %s", i.DstPath, outRoot)
 	}
-	return nil
+
+	if i.ExpectedChecksum != "" {
+		_, _, err = i.parseExpectedChecksum()
+		if err != nil {
+			return err
+		}
+	}
+	err = CheckSymlinkPolicy(i.Symlinks)
+	if err != nil {
+		return err
+	}
+	for _, c := range []Command{i.BeforeCmd, i.AfterCmd} {
+		err = c.CheckConfiguration()
+		if err != nil {
+			return err
+		}
+	}
+	return CheckPreserve(i.Preserve)
+}
+
+// preserveList returns attributes to preserve.
+// nil means default and an empty list means nothing is preserved.
+func (i SrcFile) preserveList() []string {
+	if i.Preserve == nil {
+		return defaultPreserve
+	}
+	return i.Preserve
+}
+
+// srcFilter filters files of a directory or a glob pattern.
+type srcFilter struct {
+	include *IgnoreList
+	exclude *IgnoreList
+}
+
+// accept reports whether the file should be copied.
+// rel is a slash separated path relative to the source root.
+func (f srcFilter) accept(rel string) bool {
+	if f.exclude.MatchPath(rel) {
+		return false
+	}
+	return f.include.Len() == 0 || f.include.Match(rel, false)
+}
+
+func (i *SrcFile) filter() (*srcFilter, error) {
+	include, err := NewIgnoreList(i.Include)
+	if err != nil {
+		return nil, fmt.Errorf("include:%w", err)
+	}
+	exclude, err := NewIgnoreList(i.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude:%w", err)
+	}
+	if i.IgnoreFile != "" {
+		l, err := LoadIgnoreFile(i.IgnoreFile)
+		if err != nil {
+			return nil, fmt.Errorf("ignore_file:%w", err)
+		}
+		exclude.Merge(l)
+	}
+	return &srcFilter{include: include, exclude: exclude}, nil
+}
+
+// Expand expands glob pattern or directory of Path.
+// Each matched file is returned as a copy of i.
+// If the pattern matches more than one file, DstPath is treated as a directory
+// and the layout under the pattern base is kept.
+// If Path is a directory, files are collected recursively under DstPath.
+func (i *SrcFile) Expand() ([]*SrcFile, error) {
+	f, err := i.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	if !HasMeta(i.Path) {
+		info, err := os.Lstat(i.Path)
+		if err == nil && isSymlink(info) {
+			ok, err := i.checkLink(i.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return []*SrcFile{}, nil
+			}
+			if i.symlinkPolicy() == SymlinkPreserve {
+				s, err := i.newLink(i.Path, i.DstPath)
+				if err != nil {
+					return nil, err
+				}
+				return []*SrcFile{s}, nil
+			}
+		}
+		info, err = os.Stat(i.Path)
+		if err == nil && info.IsDir() {
+			return i.expandDir(f, info)
+		}
+		// CopyAndExec modifies DstPath. Keep i as configured.
+		s := *i
+		return []*SrcFile{&s}, nil
+	}
+
+	matches, err := ExpandGlob(i.Path)
+	if err != nil {
+		return nil, fmt.Errorf("glob %s:%w", i.Path, err)
+	}
+
+	base := GlobBase(i.Path)
+	rels := []string{}
+	links := make(map[string]bool)
+	for _, v := range matches {
+		rel, err := filepath.Rel(base, v)
+		if err != nil {
+			return nil, err
+		}
+		if !f.accept(filepath.ToSlash(rel)) {
+			continue
+		}
+		info, err := os.Lstat(v)
+		if err != nil {
+			return nil, err
+		}
+		if isSymlink(info) {
+			ok, err := i.checkLink(v)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if i.symlinkPolicy() == SymlinkPreserve {
+				links[rel] = true
+			} else if info, err = os.Stat(v); err != nil || info.IsDir() {
+				// only files are matched
+				continue
+			}
+		}
+		rels = append(rels, rel)
+	}
+	if len(rels) == 0 {
+		return nil, fmt.Errorf("no file matches %s", i.Path)
+	}
+
+	ret := []*SrcFile{}
+	for _, rel := range rels {
+		dstPath := i.DstPath
+		if len(rels) > 1 {
+			dstPath = filepath.Join(i.DstPath, rel)
+		}
+		if links[rel] {
+			s, err := i.newLink(filepath.Join(base, rel), dstPath)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, s)
+			continue
+		}
+		s := *i
+		s.Path = filepath.Join(base, rel)
+		s.DstPath = dstPath
+		ret = append(ret, &s)
+	}
+	return ret, nil
+}
+
+func (i *SrcFile) expandDir(f *srcFilter, info os.FileInfo) ([]*SrcFile, error) {
+	dstDir := i.DstPath
+	if dstDir == "" {
+		dstDir = filepath.Base(i.Path)
+	}
+
+	ret := []*SrcFile{}
+	err := i.walkDir(i.Path, "", []os.FileInfo{info}, f, dstDir, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("walk %s:%w", i.Path, err)
+	}
+	return ret, nil
 }
 
 func (i *SrcFile) Normalize(outRoot string) error {
@@ -164,14 +516,30 @@ func (i *SrcFile) Normalize(outRoot string) error {
 	}
 
 	outputPath := filepath.Join(outRoot, i.DstPath)
-	if len(i.DstPath) == 0 {
+	if len(i.DstPath) == 0 || strings.HasSuffix(i.DstPath, "/") {
 		outputPath = filepath.Join(outputPath, filepath.Base(i.Path))
 	}
 	i.DstPath = outputPath
+	i.root = outRoot
 	return nil
 }
 
+// RelPath returns the slash separated path of normalized DstPath from its root.
+func (i SrcFile) RelPath() (string, error) {
+	rel, err := filepath.Rel(i.root, i.DstPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// CopyAndExec copies the file and executes hooks. Output of hooks is discarded.
 func (i *SrcFile) CopyAndExec(outRoot string) error {
+	return i.copyAndExec(outRoot, nil, nil)
+}
+
+// copyAndExec is CopyAndExec which writes output of hooks to stdout and stderr.
+func (i *SrcFile) copyAndExec(outRoot string, stdout io.Writer, stderr io.Writer) error {
 	err := i.Normalize(outRoot)
 	if err != nil {
 		return err
@@ -182,37 +550,187 @@ func (i *SrcFile) CopyAndExec(outRoot string) error {
 		return err
 	}
 
-	if len(i.BeforeCmd) > 1 {
-		err = i.ExecBeforeCmd(nil, nil)
+	hook, err := i.hookOutput(stdout, stderr)
+	if err != nil {
+		return err
+	}
+	defer hook.Close()
+
+	if !i.BeforeCmd.IsEmpty() {
+		err = i.ExecBeforeCmd(hook.stdout, hook.stderr)
 		if err != nil {
 			return err
 		}
 	}
 
+	if i.linkTarget != "" {
+		err = i.copyLink()
+		if err != nil {
+			return fmt.Errorf("copyLink:%w", err)
+		}
+		if !i.AfterCmd.IsEmpty() {
+			return i.ExecAfterCmd(hook.stdout, hook.stderr)
+		}
+		return nil
+	}
+
+	// hash in the same pass as copying unless after_cmd may modify the file.
+	algs := []string{}
+	hashOnCopy := len(i.ChecksumType) > 0 && i.AfterCmd.IsEmpty()
+	if hashOnCopy {
+		algs = append(algs, i.ChecksumType...)
+	}
+	if i.Verify || !i.AfterCmd.IsEmpty() {
+		// also for ${checksum} of after_cmd
+		algs = append(algs, i.verifyAlgorithm())
+	}
+	expectAlg := ""
+	if i.ExpectedChecksum != "" {
+		expectAlg, _, err = i.parseExpectedChecksum()
+		if err != nil {
+			return err
+		}
+		algs = append(algs, expectAlg)
+	}
+	var h *MultiHash
+	if len(algs) > 0 {
+		h, err = NewMultiHash(algs)
+		if err != nil {
+			return fmt.Errorf("CheckSum:%w", err)
+		}
+	}
+
 	// filecopy
-	err = i.CopyFile()
+	if h != nil {
+		err = i.copyFile(h)
+	} else {
+		err = i.CopyFile()
+	}
 	if err != nil {
 		return fmt.Errorf("copyFile:%w", err)
 	}
 
-	if len(i.AfterCmd) > 1 {
-		err = i.ExecAfterCmd(nil, nil)
+	// the copied bytes are checked since the source may change after another read.
+	if expectAlg != "" {
+		err = i.matchExpected(h.Sums()[expectAlg])
+		if err != nil {
+			os.Remove(i.DstPath)
+			return err
+		}
+	}
+
+	if i.Verify {
+		err = i.verifyCopy(h.Sums()[i.verifyAlgorithm()])
 		if err != nil {
 			return err
 		}
 	}
 
-	if i.ChecksumType != "" {
-		sum, err := i.ChecksumStr(i.DstPath)
+	if !i.AfterCmd.IsEmpty() {
+		i.srcSum = hex.EncodeToString(h.Sums()[i.verifyAlgorithm()])
+		err = i.ExecAfterCmd(hook.stdout, hook.stderr)
 		if err != nil {
-			return fmt.Errorf("CheckSumStr:%w", err)
+			return err
 		}
-		sumPath := i.DstPath + "." + i.ChecksumType
-		err = ioutil.WriteFile(sumPath, []byte(sum), 0644)
+	}
+
+	// after_cmd may change attributes or remove the file. e.g. gzip
+	ok, err := exists(i.DstPath)
+	if err != nil {
+		return err
+	} else if ok {
+		err = PreserveAttributes(i.Path, i.DstPath, i.preserveList())
 		if err != nil {
-			return fmt.Errorf("ioutil.WriteFile:%w", err)
+			return fmt.Errorf("preserve %s:%w", i.Path, err)
+		}
+	}
+
+	if len(i.ChecksumType) > 0 {
+		sums := make(map[string][]byte)
+		if hashOnCopy {
+			copied := h.Sums()
+			for _, v := range i.ChecksumType {
+				sums[v] = copied[v]
+			}
+		} else {
+			sums, err = i.Checksum(i.DstPath)
+			if err != nil {
+				return fmt.Errorf("CheckSum:%w", err)
+			}
+		}
+		i.sums = sums
+		for k, v := range sums {
+			sumPath := i.DstPath + "." + k
+			err = ioutil.WriteFile(sumPath, []byte(fmt.Sprintf("%x", v)), 0644)
+			if err != nil {
+				return fmt.Errorf("ioutil.WriteFile:%w", err)
+			}
 		}
 	}
 
 	return nil
 }
+
+// hookOutput returns writers for output of hooks prefixed with the source.
+// If logDir is set, output is also written to logDir/<relative path>.log.
+func (i SrcFile) hookOutput(stdout io.Writer, stderr io.Writer) (*hookOutput, error) {
+	if i.BeforeCmd.IsEmpty() && i.AfterCmd.IsEmpty() {
+		return &hookOutput{}, nil
+	}
+	logPath := ""
+	if i.logDir != "" {
+		rel, err := i.RelPath()
+		if err != nil {
+			return nil, err
+		}
+		logPath = filepath.Join(i.logDir, filepath.FromSlash(rel)+".log")
+	}
+	return newHookOutput("["+i.Path+"] ", stdout, stderr, logPath)
+}
+
+// verifyAlgorithm returns the algorithm to compare source and destination.
+func (i SrcFile) verifyAlgorithm() string {
+	if len(i.ChecksumType) > 0 {
+		return i.ChecksumType[0]
+	}
+	return "sha256"
+}
+
+// verifyCopy compares the size and the checksum of DstPath with the source.
+// srcSum is the checksum of the data read from the source while copying.
+func (i SrcFile) verifyCopy(srcSum []byte) error {
+	srcinfo, err := os.Stat(i.Path)
+	if err != nil {
+		return fmt.Errorf("verify %s:%w", i.Path, err)
+	}
+	dstinfo, err := os.Stat(i.DstPath)
+	if err != nil {
+		return fmt.Errorf("verify %s:%w", i.Path, err)
+	}
+	if srcinfo.Size() != dstinfo.Size() {
+		return fmt.Errorf("verify %s: size mismatch src=%d dst=%d", i.Path, srcinfo.Size(), dstinfo.Size())
+	}
+
+	alg := i.verifyAlgorithm()
+	sums, err := ChecksumFile(i.DstPath, []string{alg})
+	if err != nil {
+		return fmt.Errorf("verify %s:%w", i.Path, err)
+	}
+	if !bytes.Equal(sums[alg], srcSum) {
+		return fmt.Errorf("verify %s: %s mismatch\n src=%x\n dst=%x", i.Path, alg, srcSum, sums[alg])
+	}
+	return nil
+}
+
+// Sum returns the checksum of the copied file.
+// A cached value calculated by CopyAndExec is used if it exists.
+func (i *SrcFile) Sum(name string) ([]byte, error) {
+	if v, ok := i.sums[name]; ok {
+		return v, nil
+	}
+	sums, err := ChecksumFile(i.DstPath, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	return sums[name], nil
+}
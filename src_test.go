@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -46,7 +47,7 @@ func validateCommandOutput(t *testing.T, buf *bytes.Buffer, expect string) error
 func TestExecCommand(t *testing.T) {
 	buf := bytes.NewBuffer([]byte{})
 
-	src := &SrcFile{BeforeCmd: []string{"echo"}, AfterCmd: []string{"echo"}}
+	src := &SrcFile{BeforeCmd: Command{Args: []string{"echo"}}, AfterCmd: Command{Args: []string{"echo"}}}
 
 	err := src.ExecBeforeCmd(buf, buf)
 	if err != nil {
@@ -69,7 +70,7 @@ func TestExecCommand(t *testing.T) {
 	buf.Reset()
 
 	src = &SrcFile{Path: "input", DstPath: "output",
-		BeforeCmd: []string{"echo", "${target}"}, AfterCmd: []string{"echo", "${target}"}}
+		BeforeCmd: Command{Args: []string{"echo", "${target}"}}, AfterCmd: Command{Args: []string{"echo", "${target}"}}}
 
 	err = src.ExecBeforeCmd(buf, buf)
 	if err != nil {
@@ -91,8 +92,8 @@ func TestExecCommand(t *testing.T) {
 	}
 	buf.Reset()
 
-	src.BeforeCmd = []string{"echo", "file", "is", "${target}"}
-	src.AfterCmd = []string{"echo", "file", "is", "${target}"}
+	src.BeforeCmd = Command{Args: []string{"echo", "file", "is", "${target}"}}
+	src.AfterCmd = Command{Args: []string{"echo", "file", "is", "${target}"}}
 
 	err = src.ExecBeforeCmd(buf, buf)
 	if err != nil {
@@ -113,6 +114,148 @@ func TestExecCommand(t *testing.T) {
 		t.Errorf("validateCommand(ExecAfterCmd):%s", err)
 	}
 	buf.Reset()
+
+	src.AfterCmd = Command{Args: []string{"echo", "--file=${target}"}}
+	err = src.ExecAfterCmd(buf, buf)
+	if err != nil {
+		t.Errorf("ExecAfterCmd 3:%s", err)
+	}
+	err = validateCommandOutput(t, buf, "--file=output\n")
+	if err != nil {
+		t.Errorf("validateCommand(ExecAfterCmd 3):%s", err)
+	}
+	buf.Reset()
+}
+
+func TestCmdArgsPlaceholders(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "placeholders")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	srcPath := filepath.Join(tmpdir, "src", "a.tar.gz")
+	err = os.MkdirAll(filepath.Dir(srcPath), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll:%s", err)
+	}
+	err = createTxtFile(t, srcPath)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+	root := filepath.Join(tmpdir, "release")
+	src := &SrcFile{Path: srcPath, DstPath: "pkg/", ChecksumType: ChecksumList{"md5"}, jobName: "job"}
+	err = src.Normalize(root)
+	if err != nil {
+		t.Fatalf("Normalize:%s", err)
+	}
+	dst := filepath.Join(root, "pkg", "a.tar.gz")
+
+	type testcase struct {
+		name   string
+		before bool
+		input  string
+		expect string
+	}
+
+	cases := []testcase{
+		{"target", true, "${target}", srcPath},
+		{"target after", false, "--file=${target}", "--file=" + dst},
+		{"src", false, "${src}", srcPath},
+		{"dst", true, "${dst}", dst},
+		{"basename", false, "${basename}", "a.tar.gz"},
+		{"dirname", true, "${dirname}", filepath.Dir(srcPath)},
+		{"ext", false, "x${ext}", "x.gz"},
+		{"checksum", false, "${checksum}", "098f6bcd4621d373cade4e832627b4f6"},
+		{"dst_root", false, "${dst_root}/", root + "/"},
+		{"job_name", true, "${job_name}-${basename}", "job-a.tar.gz"},
+		{"unknown", true, "${unknown}", "${unknown}"},
+	}
+
+	for _, v := range cases {
+		var args []string
+		if v.before {
+			src.BeforeCmd = Command{Args: []string{"echo", v.input}}
+			args, err = src.BeforeCmdArgs()
+		} else {
+			src.AfterCmd = Command{Args: []string{"echo", v.input}}
+			args, err = src.AfterCmdArgs()
+		}
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if args[1] != v.expect {
+			t.Errorf("%s:given %s expect %s", v.name, args[1], v.expect)
+		}
+	}
+}
+
+func TestPlaceholdersChecksum(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "placeholderssum")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	srcPath := filepath.Join(tmpdir, "a.txt")
+	err = createTxtFile(t, srcPath)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+	// a script which reads the checksum without arguments
+	script := filepath.Join(tmpdir, "sum.sh")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$FC_CHECKSUM\"\n"), 0755)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		src    string
+		cmd    Command
+		expect string
+	}
+
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	cases := []testcase{
+		{"arg", srcPath, Command{Args: []string{"echo", "${checksum}"}}, sum},
+		{"script", srcPath, Command{Args: []string{script}}, sum},
+		{"user env", srcPath, Command{Args: []string{"sh", "-c", "echo $SUM"}, Env: map[string]string{"SUM": "${checksum}"}}, sum},
+	}
+
+	err = os.Mkdir(filepath.Join(tmpdir, "release"), 0755)
+	if err != nil {
+		t.Fatalf("Mkdir:%s", err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for i, v := range cases {
+		for _, after := range []bool{false, true} {
+			src := &SrcFile{Path: v.src, DstPath: fmt.Sprintf("%d-%v/", i, after)}
+			if after {
+				src.AfterCmd = v.cmd
+			} else {
+				src.BeforeCmd = v.cmd
+			}
+			buf.Reset()
+			err := src.copyAndExec(filepath.Join(tmpdir, "release"), buf, buf)
+			if err != nil {
+				t.Errorf("%s:%s", v.name, err)
+				continue
+			}
+			given := strings.TrimPrefix(strings.TrimSpace(buf.String()), "["+v.src+"] ")
+			if given != v.expect {
+				t.Errorf("%s after=%v:given %s expect %s", v.name, after, given, v.expect)
+			}
+		}
+	}
+
+	// not a regular file
+	buf.Reset()
+	src := &SrcFile{Path: tmpdir, BeforeCmd: Command{Args: []string{script}}}
+	err = src.ExecBeforeCmd(buf, buf)
+	if err != nil || buf.String() != "\n" {
+		t.Errorf("directory:given %q %v", buf.String(), err)
+	}
 }
 
 func TestChecksumStr(t *testing.T) {
@@ -147,14 +290,14 @@ func TestChecksumStr(t *testing.T) {
 	}
 
 	for _, v := range cases {
-		src.ChecksumType = v.sumType
+		src.ChecksumType = ChecksumList{v.sumType}
 		sumstr, err := src.ChecksumStr(f.Name())
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if sumstr != v.expect {
-			t.Errorf("%s error:\n given =%s\n expect=%s", v.sumType, sumstr, v.expect)
+		if sumstr[v.sumType] != v.expect {
+			t.Errorf("%s error:\n given =%s\n expect=%s", v.sumType, sumstr[v.sumType], v.expect)
 		}
 	}
 }
@@ -192,14 +335,14 @@ func TestChecksumStrTwice(t *testing.T) {
 
 	for i := 0; i < 2; i++ {
 		for _, v := range cases {
-			src.ChecksumType = v.sumType
+			src.ChecksumType = ChecksumList{v.sumType}
 			sumstr, err := src.ChecksumStr(f.Name())
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			if sumstr != v.expect {
-				t.Errorf("%s error:\n given =%s\n expect=%s", v.sumType, sumstr, v.expect)
+			if sumstr[v.sumType] != v.expect {
+				t.Errorf("%s error:\n given =%s\n expect=%s", v.sumType, sumstr[v.sumType], v.expect)
 			}
 		}
 	}
@@ -229,6 +372,18 @@ func TestDecodeJSON(t *testing.T) {
 	if err != nil {
 		t.Errorf("full case: %s\ninput=%s", err, input)
 	}
+	if len(src.ChecksumType) != 1 {
+		t.Errorf("ChecksumType is not decoded %s", src)
+	}
+
+	input = `{"path": "Path", "checksum": ["md5", "sha256"]}`
+	err = json.Unmarshal([]byte(input), &src)
+	if err != nil {
+		t.Errorf("checksum array: %s\ninput=%s", err, input)
+	}
+	if len(src.ChecksumType) != 2 {
+		t.Errorf("ChecksumType is not decoded %s", src)
+	}
 	if src.Path == "" {
 		t.Errorf("SrcPath is blank")
 	}
@@ -249,6 +404,10 @@ func TestIsSubDir(t *testing.T) {
 		{"normal", "hoge/", "hoge/a", true},
 		{"relpath", "hoge/", "../hoge/", false},
 		{"relpath2", "", "a", true},
+		{"same", "hoge", "hoge/", true},
+		{"sibling prefix", "/x/data", "/x/data-evil/secret", false},
+		{"parent", "/x/data", "/x", false},
+		{"dot dot name", "/x/data", "/x/data/..a", true},
 	}
 
 	for _, v := range cases {
@@ -375,3 +534,299 @@ func TestCopyFile(t *testing.T) {
 		}
 	}
 }
+
+func TestExpand(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "expand")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := []string{"a.txt", "b.md", "sub/c.txt"}
+	for _, v := range files {
+		p := filepath.Join(tmpdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	type testcase struct {
+		name    string
+		path    string
+		dstPath string
+		expect  []string
+	}
+
+	cases := []testcase{
+		{"no pattern", filepath.Join(tmpdir, "a.txt"), "x.txt", []string{"x.txt"}},
+		{"single match", filepath.Join(tmpdir, "*.md"), "x.md", []string{"x.md"}},
+		{"multiple match", filepath.Join(tmpdir, "**/*.txt"), "out", []string{"out/a.txt", "out/sub/c.txt"}},
+	}
+
+	for _, v := range cases {
+		s := &SrcFile{Path: v.path, DstPath: v.dstPath, BeforeCmd: Command{Args: []string{"echo", "${target}"}}}
+		ret, err := s.Expand()
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s:given %d files expect %d", v.name, len(ret), len(v.expect))
+			continue
+		}
+		for i := range ret {
+			if ret[i].DstPath != filepath.FromSlash(v.expect[i]) {
+				t.Errorf("%s:given %s expect %s", v.name, ret[i].DstPath, v.expect[i])
+			}
+			if len(ret[i].BeforeCmd.Args) != 2 {
+				t.Errorf("%s:BeforeCmd is not copied", v.name)
+			}
+		}
+	}
+
+	s := &SrcFile{Path: filepath.Join(tmpdir, "*.go")}
+	_, err = s.Expand()
+	if err == nil {
+		t.Errorf("no match should be error")
+	}
+}
+
+func TestExpandDir(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "expanddir")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := []string{"dist/a.js", "dist/a.js.map", "dist/sub/b.js", "dist/node_modules/c.js", "dist/d.txt"}
+	for _, v := range files {
+		p := filepath.Join(tmpdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	ignoreFile := filepath.Join(tmpdir, "ignore")
+	err = ioutil.WriteFile(ignoreFile, []byte("*.txt\n"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+
+	type testcase struct {
+		name   string
+		src    *SrcFile
+		expect []string
+	}
+
+	cases := []testcase{
+		{"all", &SrcFile{DstPath: "out"},
+			[]string{"out/a.js", "out/a.js.map", "out/d.txt", "out/node_modules/c.js", "out/sub/b.js"}},
+		{"no dst_path", &SrcFile{},
+			[]string{"dist/a.js", "dist/a.js.map", "dist/d.txt", "dist/node_modules/c.js", "dist/sub/b.js"}},
+		{"exclude", &SrcFile{DstPath: "out", Exclude: []string{"*.map", "node_modules/"}},
+			[]string{"out/a.js", "out/d.txt", "out/sub/b.js"}},
+		{"include", &SrcFile{DstPath: "out", Include: []string{"*.js"}, Exclude: []string{"node_modules/"}},
+			[]string{"out/a.js", "out/sub/b.js"}},
+		{"ignore file", &SrcFile{DstPath: "out", Exclude: []string{"*.map"}, IgnoreFile: ignoreFile},
+			[]string{"out/a.js", "out/node_modules/c.js", "out/sub/b.js"}},
+	}
+
+	for _, v := range cases {
+		v.src.Path = filepath.Join(tmpdir, "dist")
+		ret, err := v.src.Expand()
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s:given %d files expect %d", v.name, len(ret), len(v.expect))
+			continue
+		}
+		for i := range ret {
+			if ret[i].DstPath != filepath.FromSlash(v.expect[i]) {
+				t.Errorf("%s:given %s expect %s", v.name, ret[i].DstPath, v.expect[i])
+			}
+		}
+	}
+}
+
+func TestCopyFileChecksum(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "copyfilechecksum")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	s := &SrcFile{Path: filepath.Join(srcdir, "a.txt"), DstPath: filepath.Join(srcdir, "out", "a.txt"), ChecksumType: ChecksumList{"sha256"}}
+	err = createTxtFile(t, s.Path)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	h, err := s.newHash()
+	if err != nil {
+		t.Fatalf("newHash:%s", err)
+	}
+	err = s.copyFile(h)
+	if err != nil {
+		t.Fatalf("copyFile:%s", err)
+	}
+	given := h.Sums()["sha256"]
+
+	sums, err := s.Checksum(s.DstPath)
+	if err != nil {
+		t.Fatalf("Checksum:%s", err)
+	}
+	sum := sums["sha256"]
+	if !bytes.Equal(given, sum) {
+		t.Errorf("mismatch:\n given= %x\n expect=%x", given, sum)
+	}
+}
+
+func TestVerifySource(t *testing.T) {
+	f, err := ioutil.TempFile("", "verifysource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("abcdefg")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testcase struct {
+		name     string
+		expected string
+		success  bool
+	}
+
+	cases := []testcase{
+		{"not specified", "", true},
+		{"match", "md5:7ac66c0f148de9519b8bd264312c4d64", true},
+		{"upper case", "md5:7AC66C0F148DE9519B8BD264312C4D64", true},
+		{"mismatch", "md5:00000000000000000000000000000000", false},
+		{"unknown algorithm", "unknown:7ac66c0f148de9519b8bd264312c4d64", false},
+		{"no algorithm", "7ac66c0f148de9519b8bd264312c4d64", false},
+		{"not hex", "md5:xyz", false},
+	}
+
+	for _, v := range cases {
+		src := &SrcFile{Path: f.Name(), ExpectedChecksum: v.expected}
+		err := src.VerifySource()
+		if v.success && err != nil {
+			t.Errorf("%s:%s", v.name, err)
+		} else if !v.success && err == nil {
+			t.Errorf("%s:it should be error", v.name)
+		}
+	}
+}
+
+func TestCopyAndExecExpectedChecksum(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "expectedchecksum")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	srcPath := filepath.Join(tmpdir, "a.txt")
+	outRoot := filepath.Join(tmpdir, "release")
+	err = os.Mkdir(outRoot, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir:%s", err)
+	}
+
+	type testcase struct {
+		name     string
+		expected string
+		success  bool
+	}
+
+	cases := []testcase{
+		{"match", "md5:098f6bcd4621d373cade4e832627b4f6", true},
+		{"mismatch", "md5:00000000000000000000000000000000", false},
+		{"other algorithm", "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", true},
+	}
+
+	for _, v := range cases {
+		err = createTxtFile(t, srcPath)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+		src := &SrcFile{Path: srcPath, DstPath: v.name, ExpectedChecksum: v.expected, ChecksumType: ChecksumList{"md5"}}
+		buf := bytes.NewBuffer([]byte{})
+		err = src.copyAndExec(outRoot, buf, buf)
+		if (err == nil) != v.success {
+			t.Errorf("%s:given %v expect %v", v.name, err, v.success)
+		}
+		// the copied file is removed on mismatch.
+		ok, _ := exists(filepath.Join(outRoot, v.name))
+		if ok != v.success {
+			t.Errorf("%s:given exists=%v expect %v", v.name, ok, v.success)
+		}
+	}
+}
+
+func TestVerifyCopy(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "verifycopy")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	s := &SrcFile{Path: filepath.Join(tmpdir, "a.txt"), DstPath: "a.txt", Verify: true}
+	err = createTxtFile(t, s.Path)
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+
+	outRoot := filepath.Join(tmpdir, "out")
+	err = os.Mkdir(outRoot, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir:%s", err)
+	}
+	err = s.CopyAndExec(outRoot)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s", err)
+	}
+
+	sums, err := ChecksumFile(s.Path, []string{"sha256"})
+	if err != nil {
+		t.Fatalf("ChecksumFile:%s", err)
+	}
+	srcSum := sums["sha256"]
+
+	err = s.verifyCopy(srcSum)
+	if err != nil {
+		t.Errorf("verifyCopy:%s", err)
+	}
+
+	// truncated
+	err = ioutil.WriteFile(s.DstPath, []byte("te"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+	err = s.verifyCopy(srcSum)
+	if err == nil {
+		t.Errorf("truncated file should be error")
+	}
+
+	// same size, different content
+	err = ioutil.WriteFile(s.DstPath, []byte("TEST"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile:%s", err)
+	}
+	err = s.verifyCopy(srcSum)
+	if err == nil {
+		t.Errorf("modified file should be error")
+	}
+}
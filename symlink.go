@@ -0,0 +1,200 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Symlink policies
+const (
+	SymlinkFollow   = "follow"   // copy the target. default
+	SymlinkPreserve = "preserve" // copy as a symlink
+	SymlinkSkip     = "skip"     // ignore symlinks
+	SymlinkError    = "error"    // fail if a symlink is found
+)
+
+// CheckSymlinkPolicy checks a policy name. A blank means default.
+func CheckSymlinkPolicy(policy string) error {
+	switch policy {
+	case "", SymlinkFollow, SymlinkPreserve, SymlinkSkip, SymlinkError:
+		return nil
+	}
+	return fmt.Errorf("symlinks: unknown policy %s", policy)
+}
+
+func (i SrcFile) symlinkPolicy() string {
+	if i.Symlinks == "" {
+		return SymlinkFollow
+	}
+	return i.Symlinks
+}
+
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// linkDestination returns the absolute path which the symlink p points to.
+// A dangling link is resolved lexically.
+func linkDestination(p string) (string, error) {
+	dst, err := filepath.EvalSymlinks(p)
+	if err == nil {
+		return filepath.Abs(dst)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	target, err := os.Readlink(p)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(p), target)
+	}
+	return filepath.Abs(target)
+}
+
+// checkLink applies the symlink policy to the symlink p.
+// It returns false if p should be skipped.
+func (i SrcFile) checkLink(p string) (bool, error) {
+	switch i.symlinkPolicy() {
+	case SymlinkSkip:
+		return false, nil
+	case SymlinkError:
+		return false, fmt.Errorf("%s is a symlink", p)
+	}
+
+	if i.SymlinkRoot != "" {
+		root, err := filepath.EvalSymlinks(i.SymlinkRoot)
+		if err != nil {
+			return false, fmt.Errorf("symlink_root:%w", err)
+		}
+		dst, err := linkDestination(p)
+		if err != nil {
+			return false, err
+		}
+		if !IsSubDir(root, dst) {
+			return false, fmt.Errorf("symlink %s points to %s outside of %s", p, dst, i.SymlinkRoot)
+		}
+	}
+	return true, nil
+}
+
+// newLink returns a copy of i which copies the symlink p as a symlink.
+func (i SrcFile) newLink(p string, dstPath string) (*SrcFile, error) {
+	target, err := os.Readlink(p)
+	if err != nil {
+		return nil, err
+	}
+	s := i
+	s.Path = p
+	s.DstPath = dstPath
+	s.linkTarget = target
+	return &s, nil
+}
+
+// copyLink creates DstPath as a symlink to the same target as the source.
+func (i SrcFile) copyLink() error {
+	err := os.MkdirAll(filepath.Dir(i.DstPath), 0744)
+	if err != nil {
+		return err
+	}
+	err = os.Symlink(i.linkTarget, i.DstPath)
+	if err != nil {
+		return err
+	}
+	if hasAttribute(i.preserveList(), PreserveOwnership) && os.Geteuid() == 0 {
+		info, err := os.Lstat(i.Path)
+		if err != nil {
+			return err
+		}
+		if uid, gid, ok := fileOwner(info); ok {
+			return os.Lchown(i.DstPath, uid, gid)
+		}
+	}
+	return nil
+}
+
+// walkDir collects files under dir recursively.
+// ancestors are directories from the source root to dir to detect symlink loops.
+func (i *SrcFile) walkDir(dir string, rel string, ancestors []os.FileInfo, f *srcFilter, dstDir string, ret *[]*SrcFile) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		r := filepath.Join(rel, e.Name())
+		slashRel := filepath.ToSlash(r)
+
+		info := e
+		if isSymlink(e) {
+			ok, err := i.checkLink(p)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if i.symlinkPolicy() == SymlinkPreserve {
+				if !f.accept(slashRel) {
+					continue
+				}
+				s, err := i.newLink(p, filepath.Join(dstDir, r))
+				if err != nil {
+					return err
+				}
+				*ret = append(*ret, s)
+				continue
+			}
+			info, err = os.Stat(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		if info.IsDir() {
+			if f.exclude.Match(slashRel, true) {
+				continue
+			}
+			for _, a := range ancestors {
+				if os.SameFile(a, info) {
+					return fmt.Errorf("symlink loop detected at %s", p)
+				}
+			}
+			// full slice expression not to share the array among siblings.
+			err = i.walkDir(p, r, append(ancestors[:len(ancestors):len(ancestors)], info), f, dstDir, ret)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() || !f.accept(slashRel) {
+			continue
+		}
+
+		s := *i
+		s.Path = p
+		s.DstPath = filepath.Join(dstDir, r)
+		*ret = append(*ret, &s)
+	}
+	return nil
+}
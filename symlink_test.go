@@ -0,0 +1,252 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createLinkTree creates src/a.txt, src/link.txt -> a.txt, src/dirlink -> ../other and other/b.txt.
+func createLinkTree(t *testing.T) string {
+	t.Helper()
+
+	tmpdir, err := ioutil.TempDir("", "symlink")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	for _, v := range []string{"src", "other"} {
+		err = os.Mkdir(filepath.Join(tmpdir, v), 0755)
+		if err != nil {
+			t.Fatalf("Mkdir:%s", err)
+		}
+	}
+	for _, v := range []string{"src/a.txt", "other/b.txt"} {
+		err = createTxtFile(t, filepath.Join(tmpdir, v))
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+	err = os.Symlink("a.txt", filepath.Join(tmpdir, "src/link.txt"))
+	if err != nil {
+		t.Skipf("Symlink:%s", err)
+	}
+	err = os.Symlink("../other", filepath.Join(tmpdir, "src/dirlink"))
+	if err != nil {
+		t.Fatalf("Symlink:%s", err)
+	}
+	return tmpdir
+}
+
+func TestExpandSymlinks(t *testing.T) {
+	tmpdir := createLinkTree(t)
+	defer os.RemoveAll(tmpdir)
+
+	type testcase struct {
+		name    string
+		policy  string
+		root    string
+		success bool
+		expect  []string
+		links   int
+	}
+
+	cases := []testcase{
+		{"default", "", "", true, []string{"out/a.txt", "out/dirlink/b.txt", "out/link.txt"}, 0},
+		{"follow", SymlinkFollow, "", true, []string{"out/a.txt", "out/dirlink/b.txt", "out/link.txt"}, 0},
+		{"preserve", SymlinkPreserve, "", true, []string{"out/a.txt", "out/dirlink", "out/link.txt"}, 2},
+		{"skip", SymlinkSkip, "", true, []string{"out/a.txt"}, 0},
+		{"error", SymlinkError, "", false, nil, 0},
+		{"outside of root", SymlinkFollow, "src", false, nil, 0},
+		{"inside of root", SymlinkFollow, ".", true, []string{"out/a.txt", "out/dirlink/b.txt", "out/link.txt"}, 0},
+	}
+
+	for _, v := range cases {
+		s := &SrcFile{Path: filepath.Join(tmpdir, "src"), DstPath: "out", Symlinks: v.policy}
+		if v.root != "" {
+			s.SymlinkRoot = filepath.Join(tmpdir, v.root)
+		}
+		ret, err := s.Expand()
+		if !v.success {
+			if err == nil {
+				t.Errorf("%s:it should be error", v.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+		if len(ret) != len(v.expect) {
+			t.Errorf("%s:given %d files expect %d", v.name, len(ret), len(v.expect))
+			continue
+		}
+		links := 0
+		for i := range ret {
+			if ret[i].DstPath != filepath.FromSlash(v.expect[i]) {
+				t.Errorf("%s:given %s expect %s", v.name, ret[i].DstPath, v.expect[i])
+			}
+			if ret[i].linkTarget != "" {
+				links++
+			}
+		}
+		if links != v.links {
+			t.Errorf("%s:given %d links expect %d", v.name, links, v.links)
+		}
+	}
+}
+
+func TestExpandSymlinkLoop(t *testing.T) {
+	tmpdir := createLinkTree(t)
+	defer os.RemoveAll(tmpdir)
+
+	err := os.Symlink("..", filepath.Join(tmpdir, "other/loop"))
+	if err != nil {
+		t.Fatalf("Symlink:%s", err)
+	}
+
+	s := &SrcFile{Path: filepath.Join(tmpdir, "src")}
+	_, err = s.Expand()
+	if err == nil {
+		t.Errorf("loop should be error")
+	}
+
+	s.Symlinks = SymlinkPreserve
+	_, err = s.Expand()
+	if err != nil {
+		t.Errorf("preserve:%s", err)
+	}
+}
+
+func TestJobCopyAndExecSymlinks(t *testing.T) {
+	tmpdir := createLinkTree(t)
+	defer os.RemoveAll(tmpdir)
+
+	j := &Job{DstDir: filepath.Join(tmpdir, "release"), Symlinks: SymlinkPreserve, Manifest: &Manifest{}}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(tmpdir, "src"), DstPath: "out"})
+
+	buf := bytes.NewBuffer([]byte{})
+	err := j.CopyAndExec(buf, buf)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s %s", err, buf.String())
+	}
+
+	target, err := os.Readlink(filepath.Join(j.DstDir, "out/link.txt"))
+	if err != nil {
+		t.Fatalf("Readlink:%s", err)
+	}
+	if target != "a.txt" {
+		t.Errorf("given %s expect a.txt", target)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(j.DstDir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatalf("ReadFile:%s", err)
+	}
+	if bytes.Contains(b, []byte("link")) {
+		t.Errorf("symlinks should not be listed:%s", b)
+	}
+}
+
+func TestJobCopyAndExecSymlinksHooks(t *testing.T) {
+	tmpdir := createLinkTree(t)
+	defer os.RemoveAll(tmpdir)
+
+	type testcase struct {
+		name string
+		cmd  Command
+	}
+	cases := []testcase{
+		{"no checksum", Command{Args: []string{"true"}}},
+		{"checksum", Command{Args: []string{"echo", "${checksum}"}}},
+	}
+
+	for i, v := range cases {
+		j := &Job{DstDir: filepath.Join(tmpdir, fmt.Sprintf("release%d", i)), Symlinks: SymlinkPreserve}
+		// src/dirlink is a symlink to a directory.
+		j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(tmpdir, "src"), DstPath: "out", BeforeCmd: v.cmd, AfterCmd: v.cmd})
+
+		err := j.CopyAndExec(nil, nil)
+		if err != nil {
+			t.Errorf("%s:CopyAndExec:%s", v.name, err)
+		}
+	}
+}
+
+func TestSymlinkRootSiblingPrefix(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "symlinkroot")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, v := range []string{"data", "data-evil"} {
+		err = os.Mkdir(filepath.Join(tmpdir, v), 0755)
+		if err != nil {
+			t.Fatalf("Mkdir:%s", err)
+		}
+	}
+	err = createTxtFile(t, filepath.Join(tmpdir, "data-evil/secret.txt"))
+	if err != nil {
+		t.Fatalf("createTxtFile:%s", err)
+	}
+	err = os.Symlink("../data-evil/secret.txt", filepath.Join(tmpdir, "data/link.txt"))
+	if err != nil {
+		t.Skipf("Symlink:%s", err)
+	}
+
+	s := &SrcFile{Path: filepath.Join(tmpdir, "data"), DstPath: "out", SymlinkRoot: filepath.Join(tmpdir, "data")}
+	_, err = s.Expand()
+	if err == nil {
+		t.Errorf("a symlink to a sibling directory with the same prefix should be error")
+	}
+}
+
+func TestJobCopyAndExecSymlinksChecksum(t *testing.T) {
+	tmpdir := createLinkTree(t)
+	defer os.RemoveAll(tmpdir)
+
+	type testcase struct {
+		name string
+		src  SrcFile
+		job  Job
+	}
+	cases := []testcase{
+		{"checksum", SrcFile{ChecksumType: ChecksumList{"md5"}}, Job{}},
+		{"verify", SrcFile{Verify: true}, Job{}},
+		{"job verify", SrcFile{}, Job{Verify: true}},
+	}
+
+	for i, v := range cases {
+		j := v.job
+		j.DstDir = filepath.Join(tmpdir, fmt.Sprintf("release%d", i))
+		j.Symlinks = SymlinkPreserve
+		src := v.src
+		src.Path = filepath.Join(tmpdir, "src")
+		src.DstPath = "out"
+		j.Srcs = []*SrcFile{&src}
+
+		err := j.CopyAndExec(nil, nil)
+		if err == nil {
+			t.Errorf("%s:symlinks with checksums should be error", v.name)
+		}
+	}
+}
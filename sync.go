@@ -0,0 +1,190 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Comparison methods of incremental sync
+const (
+	CompareSizeMtime = "size_mtime" // default
+	CompareChecksum  = "checksum"
+)
+
+// Incremental is a configuration of incremental sync.
+// Only changed files are copied and merged into the existing dst.
+type Incremental struct {
+	Compare string `json:"compare,omitempty"` // size_mtime(default) or checksum
+	Delete  bool   `json:"delete,omitempty"`  // delete files of dst which are not listed
+}
+
+// UnmarshalJSON decodes the object strictly and reports positions of errors.
+func (inc *Incremental) UnmarshalJSON(b []byte) error {
+	return decodeObject(b, inc)
+}
+
+// SyncStats is counts of files processed by a job.
+type SyncStats struct {
+	Copied  int
+	Skipped int
+	Deleted int
+}
+
+// add counts a copied or skipped file.
+func (s *SyncStats) add(skipped bool) {
+	if skipped {
+		s.Skipped++
+	} else {
+		s.Copied++
+	}
+}
+
+func (s SyncStats) Print(w io.Writer) {
+	fmt.Fprintf(w, "copied:%d skipped:%d deleted:%d\n", s.Copied, s.Skipped, s.Deleted)
+}
+
+func (inc Incremental) compare() string {
+	if inc.Compare == "" {
+		return CompareSizeMtime
+	}
+	return inc.Compare
+}
+
+// CheckConfiguration checks the comparison method.
+func (inc Incremental) CheckConfiguration() error {
+	switch inc.compare() {
+	case CompareSizeMtime, CompareChecksum:
+		return nil
+	}
+	return fmt.Errorf("incremental: unknown compare %s", inc.Compare)
+}
+
+// Unchanged reports whether the copy of src under dstRoot is up to date.
+// src.DstPath should not be normalized yet.
+func (inc Incremental) Unchanged(src *SrcFile, dstRoot string) (bool, error) {
+	s := *src
+	err := s.Normalize(dstRoot)
+	if err != nil {
+		return false, err
+	}
+
+	dinfo, err := os.Lstat(s.DstPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if s.linkTarget != "" {
+		if !isSymlink(dinfo) {
+			return false, nil
+		}
+		target, err := os.Readlink(s.DstPath)
+		return target == s.linkTarget, err
+	}
+
+	if !dinfo.Mode().IsRegular() {
+		return false, nil
+	}
+	for _, v := range s.ChecksumType {
+		if ok, err := exists(s.DstPath + "." + v); err != nil || !ok {
+			return false, err
+		}
+	}
+
+	sinfo, err := os.Stat(s.Path)
+	if err != nil {
+		return false, err
+	}
+	if sinfo.Size() != dinfo.Size() {
+		return false, nil
+	}
+
+	if inc.compare() == CompareSizeMtime {
+		return sinfo.ModTime().Equal(dinfo.ModTime()), nil
+	}
+
+	alg := s.verifyAlgorithm()
+	ssum, err := ChecksumFile(s.Path, []string{alg})
+	if err != nil {
+		return false, err
+	}
+	dsum, err := ChecksumFile(s.DstPath, []string{alg})
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ssum[alg], dsum[alg]), nil
+}
+
+// DeleteUnlisted deletes files under root which are not in keep and prunes empty directories.
+// keep is a set of slash separated relative paths.
+func DeleteUnlisted(root string, keep map[string]bool) (int, error) {
+	files := []string{}
+	dirs := []string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, p)
+		} else if !keep[filepath.ToSlash(rel)] {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, v := range files {
+		err = os.Remove(v)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	// remove deeper directories at first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, v := range dirs {
+		f, err := os.Open(v)
+		if err != nil {
+			return len(files), err
+		}
+		_, err = f.Readdirnames(1)
+		f.Close()
+		if err == io.EOF {
+			err = os.Remove(v)
+			if err != nil {
+				return len(files), err
+			}
+		}
+	}
+	return len(files), nil
+}
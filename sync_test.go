@@ -0,0 +1,134 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncrementalCheckConfiguration(t *testing.T) {
+	for _, v := range []string{"", CompareSizeMtime, CompareChecksum} {
+		err := Incremental{Compare: v}.CheckConfiguration()
+		if err != nil {
+			t.Errorf("%s:%s", v, err)
+		}
+	}
+	err := Incremental{Compare: "unknown"}.CheckConfiguration()
+	if err == nil {
+		t.Errorf("unknown should be error")
+	}
+}
+
+func TestJobIncremental(t *testing.T) {
+	type step struct {
+		name   string
+		modify func(srcdir string) error
+		delete bool
+		expect SyncStats
+	}
+
+	for _, compare := range []string{CompareSizeMtime, CompareChecksum} {
+		tmpdir, err := ioutil.TempDir("", "incremental")
+		if err != nil {
+			t.Fatalf("TempDir:%s", err)
+		}
+		srcdir := filepath.Join(tmpdir, "src")
+		writeTree(t, srcdir, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+
+		steps := []step{
+			{"first", nil, false, SyncStats{Copied: 2}},
+			{"unchanged", nil, false, SyncStats{Skipped: 2}},
+			{"modified", func(srcdir string) error {
+				// keep mtime to check content is compared in checksum mode
+				mtime := time.Now().Add(time.Hour)
+				err := ioutil.WriteFile(filepath.Join(srcdir, "a.txt"), []byte("A"), 0644)
+				if err != nil {
+					return err
+				}
+				return os.Chtimes(filepath.Join(srcdir, "a.txt"), mtime, mtime)
+			}, false, SyncStats{Copied: 1, Skipped: 1}},
+			{"removed", func(srcdir string) error {
+				return os.RemoveAll(filepath.Join(srcdir, "sub"))
+			}, false, SyncStats{Skipped: 1}},
+			{"delete", nil, true, SyncStats{Skipped: 1, Deleted: 2}},
+		}
+
+		for _, v := range steps {
+			if v.modify != nil {
+				err = v.modify(srcdir)
+				if err != nil {
+					t.Fatalf("%s %s:%s", compare, v.name, err)
+				}
+			}
+
+			j := &Job{DstDir: filepath.Join(tmpdir, "release"),
+				Incremental: &Incremental{Compare: compare, Delete: v.delete}}
+			j.Srcs = append(j.Srcs, &SrcFile{Path: srcdir, DstPath: "out", ChecksumType: ChecksumList{"md5"}})
+
+			buf := bytes.NewBuffer([]byte{})
+			stats, err := j.run(buf, buf)
+			if err != nil {
+				t.Errorf("%s %s:%s", compare, v.name, err)
+				continue
+			}
+			if *stats != v.expect {
+				t.Errorf("%s %s:given %+v expect %+v", compare, v.name, *stats, v.expect)
+			}
+			if !strings.Contains(buf.String(), "copied:") {
+				t.Errorf("%s %s:stats is not printed", compare, v.name)
+			}
+		}
+
+		given := listTree(t, filepath.Join(tmpdir, "release"))
+		expect := "out/a.txt.md5:7fc56270e7a70fa81a5935b72eacbe29,out/a.txt:A"
+		if strings.Join(given, ",") != expect {
+			t.Errorf("%s:given %v expect %s", compare, given, expect)
+		}
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func TestDeleteUnlisted(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "deleteunlisted")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	writeTree(t, tmpdir, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c", "keep/d.txt": "d"})
+
+	n, err := DeleteUnlisted(tmpdir, map[string]bool{"a.txt": true, "keep/d.txt": true})
+	if err != nil {
+		t.Fatalf("DeleteUnlisted:%s", err)
+	}
+	if n != 2 {
+		t.Errorf("given %d expect 2", n)
+	}
+	given := listTree(t, tmpdir)
+	if strings.Join(given, ",") != "a.txt:a,keep/d.txt:d" {
+		t.Errorf("given %v", given)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "sub")); !os.IsNotExist(err) {
+		t.Errorf("empty directory should be removed:%s", err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Validate checks the configuration more than CheckConfiguration.
+// It returns all problems found. Sources are expanded to find duplicate destinations,
+// but dst is not touched.
+func (j Job) Validate() []error {
+	resolved, err := j.Interpolate()
+	if err != nil {
+		return []error{err}
+	}
+	j = *resolved
+
+	errs := []error{}
+	if j.DstDir == "" {
+		errs = append(errs, fmt.Errorf("dst is missing"))
+	}
+
+	for i, v := range j.Srcs {
+		if v.Path == "" {
+			errs = append(errs, fmt.Errorf("srcs[%d]: path is missing", i))
+		}
+		if filepath.IsAbs(v.DstPath) {
+			errs = append(errs, fmt.Errorf("srcs[%d]: dst_path %s should not be absolute path", i, v.DstPath))
+		}
+		for _, c := range v.ChecksumType {
+			if _, err := NewHash(c); err != nil {
+				errs = append(errs, fmt.Errorf("srcs[%d]: %s", i, err))
+			}
+		}
+	}
+
+	err = j.CheckConfiguration()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		// expanding broken srcs reports the same problems again.
+		return errs
+	}
+
+	srcs, err := j.Expand()
+	if err != nil {
+		return append(errs, err)
+	}
+
+	dst := filepath.Clean(j.DstDir)
+	dsts := make(map[string]string)
+	for _, v := range srcs {
+		err = v.Normalize(dst)
+		if err == nil {
+			err = v.checkSource(dst)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%s", v.Path, err))
+			continue
+		}
+		if prev, ok := dsts[v.DstPath]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s are copied to the same path %s", prev, v.Path, v.DstPath))
+			continue
+		}
+		dsts[v.DstPath] = v.Path
+	}
+	return errs
+}
@@ -0,0 +1,80 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobValidate(t *testing.T) {
+	srcdir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatalf("TempDir:%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	a := filepath.Join(srcdir, "a.txt")
+	b := filepath.Join(srcdir, "sub", "a.txt")
+	err = os.MkdirAll(filepath.Dir(b), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll:%s", err)
+	}
+	for _, v := range []string{a, b} {
+		err = createTxtFile(t, v)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+	dst := filepath.Join(srcdir, "release")
+
+	type testcase struct {
+		name   string
+		input  Job
+		expect []string // substrings of errors
+	}
+
+	cases := []testcase{
+		{"ok", Job{DstDir: dst, Srcs: []*SrcFile{{Path: a}, {Path: b, DstPath: "b.txt"}}}, nil},
+		{"no dst", Job{Srcs: []*SrcFile{{Path: a}}}, []string{"dst is missing"}},
+		{"no srcs", Job{DstDir: dst}, []string{"Srcs missing"}},
+		{"no path", Job{DstDir: dst, Srcs: []*SrcFile{{DstPath: "a"}}}, []string{"srcs[0]: path is missing"}},
+		{"absolute dst_path", Job{DstDir: dst, Srcs: []*SrcFile{{Path: a, DstPath: "/a.txt"}}}, []string{"should not be absolute"}},
+		{"unknown checksum", Job{DstDir: dst, Srcs: []*SrcFile{{Path: a}, {Path: b, ChecksumType: ChecksumList{"md4"}}}}, []string{"srcs[1]: Unknown checksum"}},
+		{"several problems", Job{Srcs: []*SrcFile{{Path: a, DstPath: "/a.txt"}}}, []string{"dst is missing", "should not be absolute"}},
+		{"duplicate", Job{DstDir: dst, Srcs: []*SrcFile{{Path: a}, {Path: b}}}, []string{"same path"}},
+		{"duplicate glob", Job{DstDir: dst, Srcs: []*SrcFile{{Path: filepath.Join(srcdir, "**/a.txt"), DstPath: "x/"}, {Path: a, DstPath: "x/a.txt"}}}, []string{"same path"}},
+		{"outside of dst", Job{DstDir: dst, Srcs: []*SrcFile{{Path: a, DstPath: "../a.txt"}}}, []string{"outside of root"}},
+		{"no source", Job{DstDir: dst, Srcs: []*SrcFile{{Path: filepath.Join(srcdir, "none.txt")}}}, []string{"none.txt"}},
+	}
+
+	for _, v := range cases {
+		errs := v.input.Validate()
+		if len(errs) != len(v.expect) {
+			t.Errorf("%s:given %v expect %v", v.name, errs, v.expect)
+			continue
+		}
+		for i, e := range v.expect {
+			if !strings.Contains(errs[i].Error(), e) {
+				t.Errorf("%s:given %s expect %s", v.name, errs[i], e)
+			}
+		}
+	}
+}
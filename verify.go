@@ -0,0 +1,189 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VerifyReport is a result of Verify.
+// Each path is slash separated and relative to the verified root.
+type VerifyReport struct {
+	Verified  []string
+	Missing   []string
+	Extra     []string
+	Corrupted []string
+}
+
+// OK reports whether no problem was found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Corrupted) == 0
+}
+
+// Print prints the problems and the summary.
+func (r *VerifyReport) Print(w io.Writer) {
+	for _, v := range r.Missing {
+		fmt.Fprintf(w, "missing: %s\n", v)
+	}
+	for _, v := range r.Extra {
+		fmt.Fprintf(w, "extra: %s\n", v)
+	}
+	for _, v := range r.Corrupted {
+		fmt.Fprintf(w, "corrupted: %s\n", v)
+	}
+	fmt.Fprintf(w, "verified:%d missing:%d extra:%d corrupted:%d\n",
+		len(r.Verified), len(r.Missing), len(r.Extra), len(r.Corrupted))
+}
+
+// expectedSum is a checksum which a file should have.
+type expectedSum struct {
+	algorithm string
+	sum       []byte
+}
+
+// Verify walks root and recomputes checksums of files which have
+// checksum side files (e.g. a.txt.sha256) or are listed in the manifest.
+// A file is a side file only if the file without the extension exists or is in the manifest.
+// If manifest is nil, only side files are used and no file is reported as extra.
+func Verify(root string, manifest *Manifest) (*VerifyReport, error) {
+	files := make(map[string]bool)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{}
+	expected := make(map[string][]expectedSum)
+	known := make(map[string]bool) // side files and the manifest
+	missing := make(map[string]bool)
+	listed := make(map[string]bool) // files in the manifest
+
+	manifestName := ""
+	if manifest != nil {
+		manifestName = filepath.ToSlash(manifest.FileName())
+		known[manifestName] = true
+
+		f, err := os.Open(filepath.Join(root, manifest.FileName()))
+		if err != nil {
+			return nil, fmt.Errorf("manifest:%w", err)
+		}
+		entries, err := ReadManifest(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s:%w", manifestName, err)
+		}
+
+		for _, v := range entries {
+			listed[v.Path] = true
+			if !files[v.Path] {
+				missing[v.Path] = true
+				continue
+			}
+			expected[v.Path] = append(expected[v.Path], expectedSum{algorithm: manifest.algorithm(), sum: v.Sum})
+		}
+	}
+
+	for f := range files {
+		ext := path.Ext(f)
+		if ext == "" || f == manifestName {
+			continue
+		}
+		alg := ext[1:]
+		if _, err := NewHash(alg); err != nil {
+			continue
+		}
+		// e.g. notes.md5 is a normal file unless notes exists or is in the manifest.
+		target := strings.TrimSuffix(f, ext)
+		if !files[target] && !listed[target] {
+			continue
+		}
+		known[f] = true
+		if !files[target] {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, err
+		}
+		sum, err := hex.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+		expected[target] = append(expected[target], expectedSum{algorithm: alg, sum: sum})
+	}
+
+	if manifest != nil {
+		for f := range files {
+			if !listed[f] && !known[f] {
+				report.Extra = append(report.Extra, f)
+			}
+		}
+	}
+
+	for f, sums := range expected {
+		algs := []string{}
+		for _, v := range sums {
+			algs = append(algs, v.algorithm)
+		}
+		actual, err := ChecksumFile(filepath.Join(root, filepath.FromSlash(f)), algs)
+		if err != nil {
+			return nil, err
+		}
+		ok := true
+		for _, v := range sums {
+			if !bytes.Equal(actual[v.algorithm], v.sum) {
+				ok = false
+			}
+		}
+		if ok {
+			report.Verified = append(report.Verified, f)
+		} else {
+			report.Corrupted = append(report.Corrupted, f)
+		}
+	}
+	for f := range missing {
+		report.Missing = append(report.Missing, f)
+	}
+
+	sort.Strings(report.Verified)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Corrupted)
+	return report, nil
+}
@@ -0,0 +1,139 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createVerifyDir creates a directory which is collected by a job with a manifest.
+func createVerifyDir(t *testing.T) string {
+	t.Helper()
+
+	srcdir, err := ioutil.TempDir("", "verifysrc")
+	if err != nil {
+		t.Fatalf("TempDir(src):%s", err)
+	}
+	defer os.RemoveAll(srcdir)
+
+	dstdir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatalf("TempDir(dst):%s", err)
+	}
+
+	for _, v := range []string{"a.txt", "sub/b.txt"} {
+		p := filepath.Join(srcdir, v)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("MkdirAll:%s", err)
+		}
+		err = createTxtFile(t, p)
+		if err != nil {
+			t.Fatalf("createTxtFile:%s", err)
+		}
+	}
+
+	j := &Job{DstDir: filepath.Join(dstdir, "release"), Manifest: &Manifest{}}
+	j.Srcs = append(j.Srcs, &SrcFile{Path: filepath.Join(srcdir, "**/*.txt"), ChecksumType: ChecksumList{"md5"}})
+	buf := bytes.NewBuffer([]byte{})
+	err = j.CopyAndExec(buf, buf)
+	if err != nil {
+		t.Fatalf("CopyAndExec:%s %s", err, buf.String())
+	}
+	return dstdir
+}
+
+func TestVerify(t *testing.T) {
+	type testcase struct {
+		name      string
+		manifest  *Manifest
+		modify    func(root string) error
+		missing   []string
+		extra     []string
+		corrupted []string
+	}
+
+	cases := []testcase{
+		{"intact", &Manifest{}, nil, nil, nil, nil},
+		{"intact side files", nil, nil, nil, nil, nil},
+		{"missing", &Manifest{},
+			func(root string) error { return os.Remove(filepath.Join(root, "sub/b.txt")) },
+			[]string{"sub/b.txt"}, nil, nil},
+		{"missing side files", nil,
+			func(root string) error { return os.Remove(filepath.Join(root, "sub/b.txt")) },
+			nil, nil, nil},
+		{"not side file", &Manifest{},
+			func(root string) error {
+				return ioutil.WriteFile(filepath.Join(root, "notes.md5"), []byte("notes"), 0644)
+			},
+			nil, []string{"notes.md5"}, nil},
+		{"not side file without manifest", nil,
+			func(root string) error {
+				return ioutil.WriteFile(filepath.Join(root, "notes.md5"), []byte("notes"), 0644)
+			},
+			nil, nil, nil},
+		{"extra", &Manifest{},
+			func(root string) error { return ioutil.WriteFile(filepath.Join(root, "c.txt"), []byte("c"), 0644) },
+			nil, []string{"c.txt"}, nil},
+		{"extra without manifest", nil,
+			func(root string) error { return ioutil.WriteFile(filepath.Join(root, "c.txt"), []byte("c"), 0644) },
+			nil, nil, nil},
+		{"corrupted", &Manifest{},
+			func(root string) error { return ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("x"), 0644) },
+			nil, nil, []string{"a.txt"}},
+		{"corrupted side file", nil,
+			func(root string) error { return ioutil.WriteFile(filepath.Join(root, "a.txt.md5"), []byte("00"), 0644) },
+			nil, nil, []string{"a.txt"}},
+	}
+
+	for _, v := range cases {
+		dstdir := createVerifyDir(t)
+		root := filepath.Join(dstdir, "release")
+		if v.modify != nil {
+			err := v.modify(root)
+			if err != nil {
+				t.Fatalf("%s:%s", v.name, err)
+			}
+		}
+
+		report, err := Verify(root, v.manifest)
+		os.RemoveAll(dstdir)
+		if err != nil {
+			t.Errorf("%s:%s", v.name, err)
+			continue
+		}
+
+		if strings.Join(report.Missing, ",") != strings.Join(v.missing, ",") {
+			t.Errorf("%s:missing given %v expect %v", v.name, report.Missing, v.missing)
+		}
+		if strings.Join(report.Extra, ",") != strings.Join(v.extra, ",") {
+			t.Errorf("%s:extra given %v expect %v", v.name, report.Extra, v.extra)
+		}
+		if strings.Join(report.Corrupted, ",") != strings.Join(v.corrupted, ",") {
+			t.Errorf("%s:corrupted given %v expect %v", v.name, report.Corrupted, v.corrupted)
+		}
+		ok := len(v.missing) == 0 && len(v.extra) == 0 && len(v.corrupted) == 0
+		if report.OK() != ok {
+			t.Errorf("%s:OK given %t expect %t", v.name, report.OK(), ok)
+		}
+	}
+}